@@ -0,0 +1,84 @@
+package gee
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validator is implemented by bound values that check themselves
+type Validator interface {
+	Validate() error
+}
+
+// BindingError reports a request body that couldn't be decoded
+type BindingError struct {
+	Field string // empty if the error isn't about a single field
+	Err   error
+}
+
+func (e *BindingError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("invalid value for %q: %v", e.Field, e.Err)
+	}
+	return e.Err.Error()
+}
+
+func (e *BindingError) Unwrap() error {
+	return e.Err
+}
+
+// FieldError describes an invalid field
+type FieldError struct {
+	Field  string `json:"field,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// ValidationErrors is returned by Validate to report invalid fields
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, e := range v {
+		msgs[i] = e.Field + ": " + e.Detail
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ShouldBindJSON decodes the request body into obj and validates it if
+// obj implements Validator
+func (c *Context) ShouldBindJSON(obj any) error {
+	if c.Req.Body == nil {
+		return &BindingError{Err: errors.New("empty request body")}
+	}
+	if err := json.NewDecoder(c.Req.Body).Decode(obj); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return &BindingError{Field: typeErr.Field, Err: fmt.Errorf("expected %s", typeErr.Type)}
+		}
+		return &BindingError{Err: err}
+	}
+	v, ok := obj.(Validator)
+	if !ok {
+		return nil
+	}
+	err := v.Validate()
+	var invalid ValidationErrors
+	var problem *Problem
+	if err != nil && !errors.As(err, &invalid) && !errors.As(err, &problem) {
+		// plain errors still mean the request is invalid, not the server
+		err = ValidationErrors{{Detail: err.Error()}}
+	}
+	return err
+}
+
+// BindJSON is like ShouldBindJSON, but also writes the error as a
+// problem, callers only need to return on error
+func (c *Context) BindJSON(obj any) error {
+	err := c.ShouldBindJSON(obj)
+	if err != nil {
+		c.ProblemError(err)
+	}
+	return err
+}
@@ -0,0 +1,506 @@
+package gee
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig configures ResponseCache
+type CacheConfig struct {
+	MaxBytes     int64         // upper bound of all cached entries, default 32 MiB
+	TTL          time.Duration // used when the response has no max-age, default 1 minute
+	Routes       []string      // route patterns to cache, all routes if empty
+	KeyHeaders   []string      // request headers that are part of the cache key
+	KeyQuery     []string      // query parameters that are part of the cache key, all if nil
+	MaxEntrySize int64         // responses larger than this are not cached, default MaxBytes/8
+}
+
+// ResponseCache caches whole responses of GET and HEAD requests in a
+// size-bounded LRU with TTL, and answers If-None-Match with 304. The
+// request headers named by the Vary header of a response are part of
+// the key of its entry.
+type ResponseCache struct {
+	config CacheConfig
+	routes map[string]bool
+
+	mu      sync.Mutex // guards the fields below
+	nBytes  int64
+	dl      *list.List // doubly linked list, front is the most recently used
+	entries map[string]*list.Element
+	varies  map[string]*variants // key -> entries stored under a Vary
+}
+
+// variants are the entries of a key whose response names headers in Vary
+type variants struct {
+	headers []string // request headers named by Vary
+	n       int      // number of entries
+}
+
+func (v *variants) names() []string {
+	if v == nil {
+		return nil
+	}
+	return v.headers
+}
+
+type cacheEntry struct {
+	key    string
+	base   string // key without the Vary headers, if any
+	status int
+	header http.Header
+	body   []byte
+	etag   string
+	stored time.Time
+	expire time.Time
+}
+
+func (e *cacheEntry) size() int64 {
+	n := int64(len(e.key) + len(e.base) + len(e.body))
+	for k, vs := range e.header {
+		n += int64(len(k))
+		for _, v := range vs {
+			n += int64(len(v))
+		}
+	}
+	return n
+}
+
+// NewResponseCache creates a ResponseCache, use its Middleware on the
+// groups to cache
+func NewResponseCache(config CacheConfig) *ResponseCache {
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = 32 << 20
+	}
+	if config.TTL <= 0 {
+		config.TTL = time.Minute
+	}
+	if config.MaxEntrySize <= 0 {
+		config.MaxEntrySize = config.MaxBytes / 8
+	}
+
+	rc := &ResponseCache{
+		config:  config,
+		dl:      list.New(),
+		entries: make(map[string]*list.Element),
+		varies:  make(map[string]*variants),
+	}
+	if len(config.Routes) > 0 {
+		rc.routes = make(map[string]bool, len(config.Routes))
+		for _, route := range config.Routes {
+			rc.routes[route] = true
+		}
+	}
+	return rc
+}
+
+// Middleware serves cached responses and stores cacheable ones
+func (rc *ResponseCache) Middleware() HandlerFunc {
+	return func(c *Context) {
+		if c.Method != http.MethodGet && c.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+		if rc.routes != nil && !rc.routes[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		reqCC := parseCacheControl(c.Req.Header.Get("Cache-Control"))
+		if _, ok := reqCC["no-store"]; ok {
+			c.Next()
+			return
+		}
+
+		key := rc.key(c)
+		_, noCache := reqCC["no-cache"]
+		if !noCache {
+			if e := rc.get(c, key); e != nil && fresh(e, reqCC) {
+				c.Abort()
+				rc.serve(c, e, "HIT")
+				return
+			}
+		}
+		if _, ok := reqCC["only-if-cached"]; ok {
+			c.Fail(http.StatusGatewayTimeout, "response is not cached")
+			return
+		}
+
+		w := &cacheWriter{ResponseWriter: c.Writer, limit: rc.config.MaxEntrySize}
+		c.Writer = w
+		defer func() { c.Writer = w.ResponseWriter }()
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.passthrough {
+			return
+		}
+		e := rc.store(c, key, w)
+		if e == nil {
+			// not cacheable, send the buffered response as it is
+			w.flush()
+			return
+		}
+		rc.serve(c, e, "MISS")
+	}
+}
+
+// Purge drops all cached responses
+func (rc *ResponseCache) Purge() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.dl.Init()
+	rc.entries = make(map[string]*list.Element)
+	rc.varies = make(map[string]*variants)
+	rc.nBytes = 0
+}
+
+// key builds the cache key from method, path, selected query parameters
+// and selected headers. HEAD shares the entries of GET.
+func (rc *ResponseCache) key(c *Context) string {
+	method := c.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	var sb strings.Builder
+	sb.WriteString(method + " " + c.Path)
+
+	query := c.Req.URL.Query()
+	if rc.config.KeyQuery != nil {
+		selected := url.Values{}
+		for _, name := range rc.config.KeyQuery {
+			if vs, ok := query[name]; ok {
+				selected[name] = vs
+			}
+		}
+		query = selected
+	}
+	if len(query) > 0 {
+		sb.WriteByte('?')
+		sb.WriteString(query.Encode()) // Encode sorts by key
+	}
+
+	writeHeaders(&sb, c, rc.config.KeyHeaders)
+	return sb.String()
+}
+
+// writeHeaders appends the values of the request headers names to a key
+func writeHeaders(sb *strings.Builder, c *Context, names []string) {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	for _, name := range names {
+		sb.WriteString("\n" + http.CanonicalHeaderKey(name) + ":")
+		sb.WriteString(strings.Join(c.Req.Header.Values(name), ","))
+	}
+}
+
+// varyKey extends key with the request headers named by vary
+func varyKey(c *Context, key string, vary []string) string {
+	if len(vary) == 0 {
+		return key
+	}
+	var sb strings.Builder
+	sb.WriteString(key + "\nVary")
+	writeHeaders(&sb, c, vary)
+	return sb.String()
+}
+
+// varyHeaders returns the request headers named by the Vary header of a
+// response, ok is false for "Vary: *"
+func varyHeaders(header http.Header) (names []string, ok bool) {
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			switch name {
+			case "":
+			case "*":
+				return nil, false
+			default:
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names, true
+}
+
+func (rc *ResponseCache) get(c *Context, key string) *cacheEntry {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	key = varyKey(c, key, rc.varies[key].names())
+	ele, ok := rc.entries[key]
+	if !ok {
+		return nil
+	}
+	e := ele.Value.(*cacheEntry)
+	if time.Now().After(e.expire) {
+		rc.removeElement(ele)
+		return nil
+	}
+	rc.dl.MoveToFront(ele)
+	return e
+}
+
+// store caches the captured response if it's cacheable and returns the
+// new entry, or nil otherwise
+func (rc *ResponseCache) store(c *Context, key string, w *cacheWriter) *cacheEntry {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+	default:
+		return nil
+	}
+	if c.Method == http.MethodHead {
+		return nil // no body to cache
+	}
+
+	header := w.Header()
+	resCC := parseCacheControl(strings.Join(header.Values("Cache-Control"), ","))
+	_, noStore := resCC["no-store"]
+	_, private := resCC["private"]
+	_, noCache := resCC["no-cache"]
+	if noStore || private || noCache || header.Get("Set-Cookie") != "" {
+		return nil
+	}
+	vary, ok := varyHeaders(header)
+	if !ok {
+		return nil
+	}
+	ttl := rc.config.TTL
+	for _, directive := range []string{"s-maxage", "max-age"} {
+		if v, ok := resCC[directive]; ok {
+			if secs, err := strconv.Atoi(v); err == nil {
+				ttl = time.Duration(secs) * time.Second
+				break
+			}
+		}
+	}
+	if ttl <= 0 {
+		return nil
+	}
+
+	body := w.buf.Bytes()
+	if header.Get("ETag") == "" && status == http.StatusOK {
+		sum := sha1.Sum(body)
+		header.Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	}
+	now := time.Now()
+	e := &cacheEntry{
+		key:    varyKey(c, key, vary),
+		base:   key,
+		status: status,
+		header: header.Clone(),
+		body:   append([]byte(nil), body...),
+		etag:   header.Get("ETag"),
+		stored: now,
+		expire: now.Add(ttl),
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if !equalStrings(rc.varies[key].names(), vary) {
+		// the entries stored under the former Vary can't be found anymore
+		rc.removeVariants(key)
+	}
+	if ele, ok := rc.entries[e.key]; ok {
+		rc.removeElement(ele)
+	}
+	if len(vary) > 0 {
+		v := rc.varies[key]
+		if v == nil {
+			v = &variants{headers: vary}
+			rc.varies[key] = v
+		}
+		v.n++
+	}
+	rc.entries[e.key] = rc.dl.PushFront(e)
+	rc.nBytes += e.size()
+	for rc.nBytes > rc.config.MaxBytes && rc.dl.Len() > 0 {
+		rc.removeElement(rc.dl.Back())
+	}
+	return e
+}
+
+// removeVariants drops the entries stored under key, whatever their Vary
+func (rc *ResponseCache) removeVariants(key string) {
+	for _, ele := range rc.entries {
+		if ele.Value.(*cacheEntry).base == key {
+			rc.removeElement(ele)
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (rc *ResponseCache) removeElement(ele *list.Element) {
+	e := rc.dl.Remove(ele).(*cacheEntry)
+	delete(rc.entries, e.key)
+	rc.nBytes -= e.size()
+	if v := rc.varies[e.base]; v != nil {
+		if v.n--; v.n == 0 {
+			delete(rc.varies, e.base)
+		}
+	}
+}
+
+// serve writes a cached entry, or 304 if the client copy is still valid
+func (rc *ResponseCache) serve(c *Context, e *cacheEntry, state string) {
+	header := c.Writer.Header()
+	for k, vs := range e.header {
+		header[k] = append([]string(nil), vs...)
+	}
+	header.Set("Age", strconv.Itoa(int(time.Since(e.stored).Seconds())))
+	header.Set("X-Cache", state)
+
+	if e.etag != "" && etagMatch(c.Req.Header.Get("If-None-Match"), e.etag) {
+		header.Del("Content-Length")
+		header.Del("Content-Type")
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(e.body)))
+	c.Status(e.status)
+	if c.Method != http.MethodHead {
+		c.Writer.Write(e.body)
+	}
+}
+
+// fresh reports whether e satisfies the request's max-age directive
+func fresh(e *cacheEntry, reqCC map[string]string) bool {
+	v, ok := reqCC["max-age"]
+	if !ok {
+		return true
+	}
+	maxAge, err := strconv.Atoi(v)
+	if err != nil {
+		return true
+	}
+	return time.Since(e.stored) <= time.Duration(maxAge)*time.Second
+}
+
+// parseCacheControl parses a Cache-Control header into directive -> value
+func parseCacheControl(value string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, val, _ := strings.Cut(part, "=")
+		directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(val), `"`)
+	}
+	return directives
+}
+
+// etagMatch reports whether an If-None-Match header matches etag,
+// using the weak comparison function
+func etagMatch(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheWriter buffers the response so that it can be stored and an ETag
+// added before anything is sent. Once the body grows beyond limit, the
+// buffer is flushed and the rest is written through.
+type cacheWriter struct {
+	http.ResponseWriter
+	status      int
+	buf         bytes.Buffer
+	limit       int64
+	passthrough bool
+}
+
+func (w *cacheWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *cacheWriter) Write(data []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	if int64(w.buf.Len()+len(data)) > w.limit {
+		w.flush()
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+// Flush sends what was buffered, a streamed response isn't cached
+func (w *cacheWriter) Flush() {
+	if !w.passthrough {
+		w.flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over, the response isn't cached
+func (w *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	w.passthrough = true
+	w.buf.Reset()
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying http.ResponseWriter, used by http.ResponseController
+func (w *cacheWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flush sends the buffered response and switches to write-through
+func (w *cacheWriter) flush() {
+	w.passthrough = true
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if w.buf.Len() > 0 {
+		w.ResponseWriter.Write(w.buf.Bytes())
+	}
+	w.buf.Reset()
+}
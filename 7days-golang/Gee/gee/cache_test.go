@@ -0,0 +1,86 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseCache(t *testing.T) {
+	calls := make(map[string]int)
+	r := New()
+	r.Use(NewResponseCache(CacheConfig{}).Middleware())
+	r.GET("/hello", func(c *Context) {
+		calls["/hello"]++
+		c.String(http.StatusOK, "hello")
+	})
+	r.GET("/lang", func(c *Context) {
+		calls["/lang"]++
+		c.SetHeader("Vary", "Accept-Language")
+		c.String(http.StatusOK, c.Req.Header.Get("Accept-Language"))
+	})
+	r.GET("/private", func(c *Context) {
+		calls["/private"]++
+		c.SetHeader("Cache-Control", "private, max-age=60")
+		c.String(http.StatusOK, "private")
+	})
+	r.GET("/nostore", func(c *Context) {
+		calls["/nostore"]++
+		c.SetHeader("Cache-Control", "no-store")
+		c.String(http.StatusOK, "nostore")
+	})
+	r.GET("/stream", func(c *Context) {
+		calls["/stream"]++
+		c.String(http.StatusOK, "chunk")
+		c.Writer.(http.Flusher).Flush()
+	})
+
+	serve := func(method, path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		method, path string
+		header       []string
+		cache, body  string
+	}{
+		{"GET", "/hello", nil, "MISS", "hello"},
+		{"GET", "/hello", nil, "HIT", "hello"},
+		{"HEAD", "/hello", nil, "HIT", ""},
+		{"GET", "/lang", []string{"Accept-Language", "en"}, "MISS", "en"},
+		{"GET", "/lang", []string{"Accept-Language", "fr"}, "MISS", "fr"},
+		{"GET", "/lang", []string{"Accept-Language", "en"}, "HIT", "en"},
+		{"GET", "/private", nil, "", "private"},
+		{"GET", "/private", nil, "", "private"},
+		{"GET", "/nostore", nil, "", "nostore"},
+		{"GET", "/nostore", nil, "", "nostore"},
+		{"GET", "/stream", nil, "", "chunk"},
+		{"GET", "/stream", nil, "", "chunk"},
+	}
+	for _, tt := range tests {
+		w := serve(tt.method, tt.path, tt.header...)
+		if w.Header().Get("X-Cache") != tt.cache || w.Body.String() != tt.body {
+			t.Errorf("%s %s %v = %q X-Cache %q, want %q X-Cache %q", tt.method, tt.path, tt.header,
+				w.Body, w.Header().Get("X-Cache"), tt.body, tt.cache)
+		}
+	}
+	for path, want := range map[string]int{"/hello": 1, "/lang": 2, "/private": 2, "/nostore": 2, "/stream": 2} {
+		if calls[path] != want {
+			t.Errorf("%s was called %d times, want %d", path, calls[path], want)
+		}
+	}
+
+	etag := serve("GET", "/hello").Header().Get("ETag")
+	if w := serve("GET", "/hello", "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("GET /hello with If-None-Match = %d %q, want 304", w.Code, w.Body)
+	}
+	if w := serve("GET", "/stream"); !w.Flushed {
+		t.Error("GET /stream wasn't flushed through the cache")
+	}
+}
@@ -0,0 +1,538 @@
+package gee
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CaptureConfig configures Capture
+type CaptureConfig struct {
+	Size          int      // number of exchanges kept in the ring buffer, default 100
+	MaxBodySize   int      // bytes of each body kept, default 64 KiB
+	RedactHeaders []string // default Authorization, Cookie, Set-Cookie
+	RedactFields  []string // JSON fields redacted at any depth and form fields, e.g. password
+	HARPath       string   // if set, the buffer is written there as HAR in the background
+	// HARInterval is the most often the HAR file is written, default 1s
+	HARInterval time.Duration
+}
+
+// CapturedMessage is a request or a response with its headers and body
+type CapturedMessage struct {
+	Header    http.Header `json:"header"`
+	Body      string      `json:"body"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// Exchange is a captured request and its response
+type Exchange struct {
+	ID       uint64          `json:"id"`
+	Time     time.Time       `json:"time"`
+	Duration time.Duration   `json:"duration"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Proto    string          `json:"proto"`
+	Status   int             `json:"status"`
+	Request  CapturedMessage `json:"request"`
+	Response CapturedMessage `json:"response"`
+}
+
+// Capture tees request and response bodies into a ring buffer for
+// incident debugging, see Middleware and Routes
+type Capture struct {
+	config        CaptureConfig
+	redactHeaders map[string]bool
+	redactFields  map[string]bool
+
+	harMu sync.Mutex // serializes HAR file writes
+
+	mu         sync.Mutex // guards the fields below
+	exchanges  []*Exchange
+	next       int // position of the next exchange in the ring
+	lastID     uint64
+	harPending bool // a HAR file write is scheduled
+}
+
+// ErrNotReplayable is returned by Replay when the captured request body
+// is truncated or was replaced by a placeholder
+var ErrNotReplayable = errors.New("gee: captured request body is incomplete")
+
+type replayKey struct{}
+
+// IsReplay reports whether the request is replayed by Capture. Replays
+// are marked in the request context, not by a header a client could send.
+func IsReplay(c *Context) bool {
+	return c.Req.Context().Value(replayKey{}) != nil
+}
+
+const redacted = "[REDACTED]"
+
+// redactedUnparseable replaces the bodies whose fields can't be redacted
+const redactedUnparseable = "[redacted: unparseable]"
+
+// NewCapture creates a Capture
+func NewCapture(config CaptureConfig) *Capture {
+	if config.Size <= 0 {
+		config.Size = 100
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 64 << 10
+	}
+	if config.RedactHeaders == nil {
+		config.RedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+	}
+	if config.HARInterval <= 0 {
+		config.HARInterval = time.Second
+	}
+
+	cp := &Capture{
+		config:        config,
+		redactHeaders: make(map[string]bool),
+		redactFields:  make(map[string]bool),
+		exchanges:     make([]*Exchange, 0, config.Size),
+	}
+	for _, name := range config.RedactHeaders {
+		cp.redactHeaders[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, name := range config.RedactFields {
+		cp.redactFields[strings.ToLower(name)] = true
+	}
+	return cp
+}
+
+// Middleware captures every exchange passing through the handler chain
+func (cp *Capture) Middleware() HandlerFunc {
+	return func(c *Context) {
+		if IsReplay(c) {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		ex := &Exchange{
+			Time:   start,
+			Method: c.Method,
+			URL:    c.Req.URL.String(),
+			Proto:  c.Req.Proto,
+		}
+		ex.Request.Header = c.Req.Header.Clone()
+
+		var reqBody limitedBuffer
+		reqBody.limit = cp.config.MaxBodySize
+		if c.Req.Body != nil && c.Req.Body != http.NoBody {
+			// read ahead so that the body is captured even if the handler
+			// doesn't read it, then hand the whole body to the handler
+			head, _ := io.ReadAll(io.LimitReader(c.Req.Body, int64(cp.config.MaxBodySize)+1))
+			reqBody.Write(head)
+			c.Req.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(head), c.Req.Body), Closer: c.Req.Body}
+		}
+		w := &captureWriter{ResponseWriter: c.Writer}
+		w.body.limit = cp.config.MaxBodySize
+		c.Writer = w
+		defer func() {
+			c.Writer = w.ResponseWriter
+
+			ex.Duration = time.Since(start)
+			ex.Status = c.writer.Status()
+			ex.Request.Body, ex.Request.Truncated = cp.redactBody(&reqBody, ex.Request.Header)
+			ex.Response.Header = w.Header().Clone()
+			ex.Response.Body, ex.Response.Truncated = cp.redactBody(&w.body, ex.Response.Header)
+			cp.redactHeader(ex.Request.Header)
+			cp.redactHeader(ex.Response.Header)
+			cp.add(ex)
+		}()
+		c.Next()
+	}
+}
+
+// Routes registers the debug endpoints on group:
+//
+//	GET  /captures             list the captured exchanges
+//	GET  /captures/:id         get one exchange
+//	GET  /captures.har         download the buffer as HAR
+//	POST /captures/:id/replay  replay the request in-process and return the new exchange
+//
+// The exchanges may still hold personal data and the replays run with
+// the credentials of the caller, so protect the group with an
+// authentication middleware.
+func (cp *Capture) Routes(group *RouterGroup) {
+	group.GET("/captures", func(c *Context) {
+		c.JSON(http.StatusOK, cp.Exchanges())
+	})
+	group.GET("/captures.har", func(c *Context) {
+		c.SetHeader("Content-Type", "application/json")
+		c.SetHeader("Content-Disposition", `attachment; filename="captures.har"`)
+		c.Status(http.StatusOK)
+		cp.WriteHAR(c.Writer)
+	})
+	group.GET("/captures/:id", func(c *Context) {
+		ex := cp.lookup(c)
+		if ex == nil {
+			c.Fail(http.StatusNotFound, "no such exchange")
+			return
+		}
+		c.JSON(http.StatusOK, ex)
+	})
+	group.POST("/captures/:id/replay", func(c *Context) {
+		ex := cp.lookup(c)
+		if ex == nil {
+			c.Fail(http.StatusNotFound, "no such exchange")
+			return
+		}
+		res, err := cp.Replay(c.engine, ex, c.Req.Header)
+		if err != nil {
+			c.Fail(http.StatusConflict, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, res)
+	})
+}
+
+func (cp *Capture) lookup(c *Context) *Exchange {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	return cp.Exchange(id)
+}
+
+// Exchanges returns the captured exchanges, oldest first
+func (cp *Capture) Exchanges() []*Exchange {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	if len(cp.exchanges) < cp.config.Size {
+		return append([]*Exchange(nil), cp.exchanges...)
+	}
+	return append(append([]*Exchange(nil), cp.exchanges[cp.next:]...), cp.exchanges[:cp.next]...)
+}
+
+// Exchange returns the captured exchange of id, or nil
+func (cp *Capture) Exchange(id uint64) *Exchange {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	for _, ex := range cp.exchanges {
+		if ex.ID == id {
+			return ex
+		}
+	}
+	return nil
+}
+
+// Replay serves the captured request again with engine, in-process, and
+// returns the resulting exchange, which is not captured. Only the
+// redacted request is kept, so the redacted headers, e.g. the
+// credentials, are taken from header instead, and the redacted body
+// fields are sent as they are. It fails with ErrNotReplayable if the body
+// wasn't captured whole.
+func (cp *Capture) Replay(engine *Engine, ex *Exchange, header http.Header) (*Exchange, error) {
+	if ex.Request.Truncated || ex.Request.Body == redactedUnparseable {
+		return nil, ErrNotReplayable
+	}
+	req := httptest.NewRequest(ex.Method, ex.URL, strings.NewReader(ex.Request.Body))
+	req = req.WithContext(context.WithValue(req.Context(), replayKey{}, ex.ID))
+	req.Header = ex.Request.Header.Clone()
+	for name := range cp.redactHeaders {
+		req.Header.Del(name)
+		if values := header.Values(name); len(values) > 0 {
+			req.Header[name] = append([]string(nil), values...)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	engine.ServeHTTP(rec, req)
+
+	res := &Exchange{
+		ID:       ex.ID,
+		Time:     start,
+		Duration: time.Since(start),
+		Method:   ex.Method,
+		URL:      ex.URL,
+		Proto:    ex.Proto,
+		Status:   rec.Code,
+		Request:  ex.Request,
+	}
+	var body limitedBuffer
+	body.limit = cp.config.MaxBodySize
+	body.Write(rec.Body.Bytes())
+	res.Response.Header = rec.Header().Clone()
+	res.Response.Body, res.Response.Truncated = cp.redactBody(&body, res.Response.Header)
+	cp.redactHeader(res.Response.Header)
+	return res, nil
+}
+
+func (cp *Capture) add(ex *Exchange) {
+	cp.mu.Lock()
+	cp.lastID++
+	ex.ID = cp.lastID
+	if len(cp.exchanges) < cp.config.Size {
+		cp.exchanges = append(cp.exchanges, ex)
+	} else {
+		cp.exchanges[cp.next] = ex
+	}
+	cp.next = (cp.next + 1) % cp.config.Size
+	schedule := cp.config.HARPath != "" && !cp.harPending
+	if schedule {
+		cp.harPending = true
+	}
+	cp.mu.Unlock()
+
+	if schedule {
+		// the exchanges captured until then are written at once
+		time.AfterFunc(cp.config.HARInterval, func() {
+			cp.mu.Lock()
+			cp.harPending = false
+			cp.mu.Unlock()
+			cp.writeHARFile()
+		})
+	}
+}
+
+func (cp *Capture) writeHARFile() {
+	cp.harMu.Lock()
+	defer cp.harMu.Unlock()
+
+	tmp := cp.config.HARPath + ".tmp"
+	f, err := os.Create(tmp)
+	if err == nil {
+		err = cp.WriteHAR(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp, cp.config.HARPath)
+	}
+	if err != nil {
+		debugPrintf("[Capture] write HAR file: %v", err)
+	}
+}
+
+func (cp *Capture) redactHeader(header http.Header) {
+	for name := range header {
+		if cp.redactHeaders[name] {
+			header[name] = []string{redacted}
+		}
+	}
+}
+
+// redactBody returns the captured body with the configured JSON and form
+// fields redacted, and whether it was truncated. A body which may hold
+// such fields but can't be parsed, e.g. a truncated one, is replaced by
+// a placeholder.
+func (cp *Capture) redactBody(b *limitedBuffer, header http.Header) (string, bool) {
+	body := b.Bytes()
+	if len(cp.redactFields) == 0 {
+		return string(body), b.truncated
+	}
+
+	contentType := header.Get("Content-Type")
+	switch trimmed := bytes.TrimSpace(body); {
+	case strings.Contains(contentType, "json") || bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("[")):
+		var doc any
+		if b.truncated || json.Unmarshal(body, &doc) != nil {
+			return redactedUnparseable, b.truncated
+		}
+		out, err := json.Marshal(cp.redactJSON(doc))
+		if err != nil {
+			return redactedUnparseable, false
+		}
+		return string(out), false
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		values, err := url.ParseQuery(string(body))
+		if b.truncated || err != nil {
+			return redactedUnparseable, b.truncated
+		}
+		for key := range values {
+			if cp.redactFields[strings.ToLower(key)] {
+				values[key] = []string{redacted}
+			}
+		}
+		return values.Encode(), false
+	}
+	return string(body), b.truncated
+}
+
+func (cp *Capture) redactJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if cp.redactFields[strings.ToLower(key)] {
+				v[key] = redacted
+			} else {
+				v[key] = cp.redactJSON(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = cp.redactJSON(value)
+		}
+	}
+	return v
+}
+
+// WriteHAR writes the captured exchanges as a HAR 1.2 log
+func (cp *Capture) WriteHAR(w io.Writer) error {
+	type harNV struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+	type harContent struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	}
+	type harEntry struct {
+		StartedDateTime string `json:"startedDateTime"`
+		Time            int64  `json:"time"`
+		Request         struct {
+			Method      string      `json:"method"`
+			URL         string      `json:"url"`
+			HTTPVersion string      `json:"httpVersion"`
+			Headers     []harNV     `json:"headers"`
+			QueryString []harNV     `json:"queryString"`
+			PostData    *harContent `json:"postData,omitempty"`
+			HeadersSize int         `json:"headersSize"`
+			BodySize    int         `json:"bodySize"`
+		} `json:"request"`
+		Response struct {
+			Status      int        `json:"status"`
+			StatusText  string     `json:"statusText"`
+			HTTPVersion string     `json:"httpVersion"`
+			Headers     []harNV    `json:"headers"`
+			Content     harContent `json:"content"`
+			RedirectURL string     `json:"redirectURL"`
+			HeadersSize int        `json:"headersSize"`
+			BodySize    int        `json:"bodySize"`
+		} `json:"response"`
+		Cache   struct{}       `json:"cache"`
+		Timings map[string]int `json:"timings"`
+	}
+	headers := func(h http.Header) []harNV {
+		nvs := []harNV{}
+		for name, values := range h {
+			for _, value := range values {
+				nvs = append(nvs, harNV{name, value})
+			}
+		}
+		return nvs
+	}
+
+	entries := []harEntry{}
+	for _, ex := range cp.Exchanges() {
+		var e harEntry
+		e.StartedDateTime = ex.Time.Format(time.RFC3339Nano)
+		e.Time = ex.Duration.Milliseconds()
+		e.Request.Method = ex.Method
+		e.Request.URL = ex.URL
+		e.Request.HTTPVersion = ex.Proto
+		e.Request.Headers = headers(ex.Request.Header)
+		e.Request.QueryString = []harNV{}
+		if req, err := http.NewRequest(ex.Method, ex.URL, nil); err == nil {
+			for name, values := range req.URL.Query() {
+				for _, value := range values {
+					e.Request.QueryString = append(e.Request.QueryString, harNV{name, value})
+				}
+			}
+		}
+		if ex.Request.Body != "" {
+			e.Request.PostData = &harContent{
+				Size:     len(ex.Request.Body),
+				MimeType: ex.Request.Header.Get("Content-Type"),
+				Text:     ex.Request.Body,
+			}
+		}
+		e.Request.HeadersSize, e.Request.BodySize = -1, len(ex.Request.Body)
+		e.Response.Status = ex.Status
+		e.Response.StatusText = http.StatusText(ex.Status)
+		e.Response.HTTPVersion = ex.Proto
+		e.Response.Headers = headers(ex.Response.Header)
+		e.Response.Content = harContent{
+			Size:     len(ex.Response.Body),
+			MimeType: ex.Response.Header.Get("Content-Type"),
+			Text:     ex.Response.Body,
+		}
+		e.Response.HeadersSize, e.Response.BodySize = -1, len(ex.Response.Body)
+		e.Timings = map[string]int{"send": 0, "wait": int(e.Time), "receive": 0}
+		entries = append(entries, e)
+	}
+
+	doc := map[string]any{
+		"log": map[string]any{
+			"version": "1.2",
+			"creator": map[string]string{"name": "gee", "version": "1"},
+			"entries": entries,
+		},
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// limitedBuffer keeps at most limit bytes and remembers if more were written
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(p[:room])
+		}
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// captureWriter tees the response body into a limitedBuffer
+type captureWriter struct {
+	http.ResponseWriter
+	body limitedBuffer
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush implements http.Flusher
+func (w *captureWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker, nothing is captured after it
+func (w *captureWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap returns the underlying http.ResponseWriter
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
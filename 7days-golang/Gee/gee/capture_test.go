@@ -0,0 +1,135 @@
+package gee
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCapture(t *testing.T) {
+	har := filepath.Join(t.TempDir(), "captures.har")
+	cp := NewCapture(CaptureConfig{
+		MaxBodySize:  32,
+		RedactFields: []string{"password"},
+		HARPath:      har,
+		HARInterval:  10 * time.Millisecond,
+	})
+	r := New()
+	r.Use(cp.Middleware())
+	r.POST("/login", func(c *Context) {
+		if c.Req.Header.Get("Authorization") != "Bearer secret" {
+			c.Fail(http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		body, _ := io.ReadAll(c.Req.Body)
+		c.String(http.StatusOK, "%d bytes", len(body))
+	})
+	post := func(body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer secret")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	post(`{"password":"hunter2"}`)
+	post(`{}`, "X-Gee-Replay", "1")
+	post(`{"password":"a much longer body than the limit"}`)
+
+	exchanges := cp.Exchanges()
+	if len(exchanges) != 3 {
+		t.Fatalf("captured %d exchanges, want 3 whatever the headers", len(exchanges))
+	}
+	ex := exchanges[0]
+	if ex.Request.Header.Get("Authorization") != redacted || ex.Request.Body != `{"password":"[REDACTED]"}` {
+		t.Fatalf("exchange not redacted: %+v", ex.Request)
+	}
+
+	// fields of bodies which can't be parsed can't be redacted either
+	if req := exchanges[2].Request; req.Body != redactedUnparseable || !req.Truncated {
+		t.Fatalf("over-limit JSON body captured as %q", req.Body)
+	}
+	var req limitedBuffer
+	req.limit = 32
+	req.WriteString(`{"password": "hunter2"`)
+	if body, _ := cp.redactBody(&req, http.Header{}); body != redactedUnparseable {
+		t.Fatalf("invalid JSON body captured as %q", body)
+	}
+	req.Reset()
+	req.WriteString("user=tom&password=hunter2")
+	if body, _ := cp.redactBody(&req, http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}); body != "password=%5BREDACTED%5D&user=tom" {
+		t.Fatalf("form body captured as %q", body)
+	}
+
+	// redacted headers are replaced by the ones of the caller
+	if res, err := cp.Replay(r, ex, nil); err != nil || res.Status != http.StatusUnauthorized {
+		t.Fatalf("Replay without credentials = %+v, %v, want 401", res, err)
+	}
+	res, err := cp.Replay(r, ex, http.Header{"Authorization": {"Bearer secret"}})
+	if err != nil || res.Status != http.StatusOK {
+		t.Fatalf("Replay = %+v, %v, want the authenticated request replayed", res, err)
+	}
+	if res.Response.Body != "25 bytes" {
+		t.Fatalf("replayed body = %q, want the redacted one", res.Response.Body)
+	}
+	if n := len(cp.Exchanges()); n != 3 {
+		t.Fatalf("the replay was captured, %d exchanges", n)
+	}
+	if _, err := cp.Replay(r, exchanges[2], nil); err != ErrNotReplayable {
+		t.Fatalf("Replay of a truncated request = %v, want ErrNotReplayable", err)
+	}
+
+	// the HAR file is written once the interval elapsed
+	var doc struct {
+		Log struct {
+			Entries []json.RawMessage `json:"entries"`
+		} `json:"log"`
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		data, err := os.ReadFile(har)
+		if err == nil && json.Unmarshal(data, &doc) == nil && len(doc.Log.Entries) == 3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("HAR file has %d entries, err %v", len(doc.Log.Entries), err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCaptureHijack(t *testing.T) {
+	r := New()
+	r.Use(NewCapture(CaptureConfig{}).Middleware())
+	r.GET("/ws", func(c *Context) {
+		conn, rw, err := c.Writer.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		rw.Flush()
+	})
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if body, _ := io.ReadAll(res.Body); string(body) != "hijacked" {
+		t.Fatalf("GET /ws = %q", body)
+	}
+}
@@ -0,0 +1,114 @@
+package gee
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// DefaultETagMaxSize is the largest body the ETag middleware buffers
+const DefaultETagMaxSize = 64 << 10
+
+// DataWithETag write data with a strong ETag, answering conditional and
+// Range requests, including multi-range ones, like http.ServeContent
+func (c *Context) DataWithETag(contentType string, data []byte) {
+	sum := sha1.Sum(data)
+	c.SetHeader("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	if contentType != "" {
+		c.SetHeader("Content-Type", contentType)
+	}
+	http.ServeContent(c.Writer, c.Req, "", time.Time{}, bytes.NewReader(data))
+}
+
+// File write the named file, honouring If-Modified-Since, If-None-Match
+// and Range
+func (c *Context) File(filepath string) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	defer f.Close()
+	c.serveFile(f, filepath)
+}
+
+// FileFromFS is like File, but opens name in fs
+func (c *Context) FileFromFS(name string, fs http.FileSystem) {
+	f, err := fs.Open(name)
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	defer f.Close()
+	c.serveFile(f, name)
+}
+
+func (c *Context) serveFile(f http.File, name string) {
+	info, err := f.Stat()
+	if err != nil {
+		c.fileError(err)
+		return
+	}
+	if info.IsDir() {
+		c.Fail(http.StatusNotFound, "no such file: "+path.Base(name))
+		return
+	}
+	// the name is only used to guess the Content-Type
+	http.ServeContent(c.Writer, c.Req, info.Name(), info.ModTime(), f)
+}
+
+func (c *Context) fileError(err error) {
+	switch {
+	case os.IsNotExist(err):
+		c.Fail(http.StatusNotFound, "file not found")
+	case os.IsPermission(err):
+		c.Fail(http.StatusForbidden, "permission denied")
+	default:
+		c.ProblemError(err)
+	}
+}
+
+// ETag adds a weak ETag to successful GET and HEAD responses up to
+// maxSize bytes, and answers matching If-None-Match with 304. Larger
+// responses and the ones that already have an ETag are left alone.
+func ETag(maxSize int) HandlerFunc {
+	if maxSize <= 0 {
+		maxSize = DefaultETagMaxSize
+	}
+	return func(c *Context) {
+		if c.Method != http.MethodGet && c.Method != http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &cacheWriter{ResponseWriter: c.Writer, limit: int64(maxSize)}
+		c.Writer = w
+		defer func() { c.Writer = w.ResponseWriter }()
+		c.Next()
+		c.Writer = w.ResponseWriter
+
+		if w.passthrough {
+			return
+		}
+		header := w.Header()
+		if (w.status != 0 && w.status != http.StatusOK) || header.Get("ETag") != "" || w.buf.Len() == 0 {
+			w.flush()
+			return
+		}
+
+		sum := sha1.Sum(w.buf.Bytes())
+		etag := `W/"` + hex.EncodeToString(sum[:]) + `"`
+		header.Set("ETag", etag)
+		if etagMatch(c.Req.Header.Get("If-None-Match"), etag) {
+			header.Del("Content-Length")
+			header.Del("Content-Type")
+			w.buf.Reset()
+			w.status = http.StatusNotModified
+		}
+		w.flush()
+	}
+}
@@ -0,0 +1,112 @@
+package gee
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContent(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello, world"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	r := New()
+	r.Use(Logger())
+	r.GET("/data", func(c *Context) {
+		c.DataWithETag("text/plain", []byte("0123456789"))
+	})
+	r.GET("/files/*name", func(c *Context) {
+		c.File(filepath.Join(dir, c.Param("name")))
+	})
+	r.GET("/fs/*name", func(c *Context) {
+		c.FileFromFS(c.Param("name"), http.Dir(dir))
+	})
+	etag := r.Group("/etag")
+	etag.Use(ETag(8))
+	etag.GET("/small", func(c *Context) {
+		c.String(http.StatusOK, "small")
+	})
+	etag.GET("/large", func(c *Context) {
+		c.String(http.StatusOK, "larger than eight bytes")
+	})
+	etag.GET("/error", func(c *Context) {
+		c.String(http.StatusInternalServerError, "oops")
+	})
+
+	serve := func(path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/data")
+	tag := w.Header().Get("ETag")
+	if w.Code != 200 || w.Body.String() != "0123456789" || !strings.HasPrefix(tag, `"`) {
+		t.Fatalf("GET /data = %d %q, ETag %q", w.Code, w.Body, tag)
+	}
+	tests := []struct {
+		path   string
+		header []string
+		code   int
+		body   string
+	}{
+		{"/data", []string{"If-None-Match", tag}, 304, ""},
+		{"/data", []string{"Range", "bytes=2-4"}, 206, "234"},
+		{"/data", []string{"Range", "bytes=20-"}, 416, ""},
+		{"/data", []string{"Range", "bytes=2-4", "If-Range", `"stale"`}, 200, "0123456789"},
+		{"/files/hello.txt", nil, 200, "hello, world"},
+		{"/files/hello.txt", []string{"Range", "bytes=-5"}, 206, "world"},
+		{"/files/missing.txt", nil, 404, ""},
+		{"/fs/hello.txt", nil, 200, "hello, world"},
+		{"/fs/sub", nil, 404, ""},
+	}
+	for _, tt := range tests {
+		w := serve(tt.path, tt.header...)
+		if w.Code != tt.code || tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("GET %s %v = %d %q, want %d %q", tt.path, tt.header, w.Code, w.Body, tt.code, tt.body)
+		}
+	}
+
+	// the logger sees the status written by http.ServeContent
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	serve("/data", "Range", "bytes=2-4")
+	serve("/data", "If-None-Match", tag)
+	log.SetOutput(os.Stderr)
+	if out := logged.String(); !strings.Contains(out, "[206] /data") || !strings.Contains(out, "[304] /data") {
+		t.Errorf("Logger printed %q, want the 206 and 304 statuses", out)
+	}
+
+	w = serve("/files/hello.txt")
+	if w := serve("/files/hello.txt", "If-Modified-Since", w.Header().Get("Last-Modified")); w.Code != 304 {
+		t.Errorf("GET /files/hello.txt with If-Modified-Since = %d, want 304", w.Code)
+	}
+
+	w = serve("/etag/small")
+	weak := w.Header().Get("ETag")
+	if !strings.HasPrefix(weak, `W/"`) || w.Body.String() != "small" {
+		t.Fatalf("GET /etag/small = %q, ETag %q", w.Body, weak)
+	}
+	if w := serve("/etag/small", "If-None-Match", weak); w.Code != 304 || w.Body.Len() != 0 {
+		t.Errorf("GET /etag/small with If-None-Match = %d %q, want 304", w.Code, w.Body)
+	}
+	for _, path := range []string{"/etag/large", "/etag/error"} {
+		if w := serve(path); w.Header().Get("ETag") != "" || w.Body.Len() == 0 {
+			t.Errorf("GET %s = %q, ETag %q, want no ETag", path, w.Body, w.Header().Get("ETag"))
+		}
+	}
+}
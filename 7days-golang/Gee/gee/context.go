@@ -3,7 +3,10 @@ package gee
 import (
 	"encoding/json"
 	"fmt"
+	"html/template"
+	"net"
 	"net/http"
+	"strings"
 )
 
 type H map[string]any
@@ -15,21 +18,30 @@ type Context struct {
 	Path   string
 	Method string
 	Params map[string]string // Dynamic route parameters
+	// Matched route pattern, e.g. /hello/:name
+	fullPath string
 	// Response info
 	StatusCode int
+	writer     *responseWriter
 	// Middleware
 	handlers []HandlerFunc
 	index    int
+	// Per-request key/value pairs shared by middlewares and handlers
+	Keys map[string]any
+	// Per-request template functions
+	funcMap template.FuncMap
 	// engine
 	engine *Engine
 }
 
 func newContext(w http.ResponseWriter, req *http.Request) *Context {
+	writer := newResponseWriter(w)
 	return &Context{
-		Writer: w,
+		Writer: writer,
 		Req:    req,
 		Path:   req.URL.Path,
 		Method: req.Method,
+		writer: writer,
 		index:  -1,
 	}
 }
@@ -43,6 +55,65 @@ func (c *Context) Next() {
 	}
 }
 
+// FullPath return the matched route pattern, e.g. /hello/:name,
+// or an empty string if no route matched
+func (c *Context) FullPath() string {
+	return c.fullPath
+}
+
+// Written return whether the response header has already been written
+func (c *Context) Written() bool {
+	return c.writer.Written()
+}
+
+// Set store a new key/value pair for this context
+func (c *Context) Set(key string, value any) {
+	if c.Keys == nil {
+		c.Keys = make(map[string]any)
+	}
+	c.Keys[key] = value
+}
+
+// Get return the value for the given key and whether it exists
+func (c *Context) Get(key string) (value any, exists bool) {
+	value, exists = c.Keys[key]
+	return
+}
+
+// ClientIP return the client IP. X-Forwarded-For and X-Real-Ip are only
+// believed when the request comes from a proxy trusted with
+// Engine.SetTrustedProxies, otherwise any client could pick its IP.
+func (c *Context) ClientIP() string {
+	remote := strings.TrimSpace(c.Req.RemoteAddr)
+	if ip, _, err := net.SplitHostPort(remote); err == nil {
+		remote = ip
+	}
+	if c.engine == nil || !c.engine.isTrustedProxy(remote) {
+		return remote
+	}
+
+	if xff := c.Req.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+		// walk the hops from the closest proxy, the first untrusted
+		// address is the client
+		hops := strings.Split(strings.Join(xff, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(hops[i])
+			if net.ParseIP(ip) == nil {
+				break
+			}
+			remote = ip
+			if !c.engine.isTrustedProxy(ip) {
+				break
+			}
+		}
+		return remote
+	}
+	if ip := strings.TrimSpace(c.Req.Header.Get("X-Real-Ip")); net.ParseIP(ip) != nil {
+		return ip
+	}
+	return remote
+}
+
 // PostForm return form value of the key
 func (c *Context) PostForm(key string) string {
 	return c.Req.FormValue(key)
@@ -87,11 +158,30 @@ func (c *Context) Data(code int, data []byte) {
 	c.Writer.Write(data)
 }
 
+// SetFunc set a template function for this request only, overriding the
+// one of the same name registered when templates were loaded
+func (c *Context) SetFunc(name string, fn any) {
+	if c.funcMap == nil {
+		c.funcMap = make(template.FuncMap)
+	}
+	c.funcMap[name] = fn
+}
+
 // HTML write HTML data into HTTP response
 func (c *Context) HTML(code int, tmplName string, data any) {
+	tmpls := c.engine.htmlTmpls
+	if len(c.funcMap) > 0 {
+		clone, err := c.engine.htmlBase.Clone()
+		if err != nil {
+			c.Fail(500, err.Error())
+			return
+		}
+		tmpls = clone.Funcs(c.funcMap)
+	}
+
 	c.SetHeader("Content-Type", "text/html")
 	c.Status(code)
-	if err := c.engine.htmlTmpls.ExecuteTemplate(c.Writer, tmplName, data); err != nil {
+	if err := tmpls.ExecuteTemplate(c.Writer, tmplName, data); err != nil {
 		c.Fail(500, err.Error())
 	}
 }
@@ -102,7 +192,12 @@ func (c *Context) Param(key string) string {
 	return val
 }
 
-func (c *Context) Fail(code int, errMsg string) {
+// Abort prevent the pending handlers in the chain from being called
+func (c *Context) Abort() {
 	c.index = len(c.handlers)
-	c.JSON(code, H{"message": errMsg})
+}
+
+// Fail abort the chain and write errMsg as a problem detail
+func (c *Context) Fail(code int, errMsg string) {
+	c.Problem(NewProblem(code, errMsg))
 }
@@ -0,0 +1,208 @@
+package gee
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CSRFMode selects how CSRFProtect verifies submitted tokens
+type CSRFMode int
+
+const (
+	// CSRFDoubleSubmit compares the submitted token with the one in a cookie
+	CSRFDoubleSubmit CSRFMode = iota
+	// CSRFSynchronizer compares the submitted token with the one kept in a
+	// server-side CSRFStore for the session
+	CSRFSynchronizer
+)
+
+// CSRFStore keeps the synchronizer tokens per session
+type CSRFStore interface {
+	Token(sessionID string) (string, bool)
+	SetToken(sessionID string, token string)
+}
+
+// CSRFConfig configures CSRFProtect
+type CSRFConfig struct {
+	Mode         CSRFMode
+	CookieName   string        // token cookie, or session cookie in synchronizer mode, default "_csrf"
+	HeaderName   string        // default "X-CSRF-Token"
+	FormField    string        // default "csrf_token"
+	CookiePath   string        // default "/"
+	CookieMaxAge time.Duration // default 12 hours
+	Secure       bool          // send the cookie over HTTPS only
+	SameSite     http.SameSite // default Lax
+	Store        CSRFStore     // synchronizer mode only, default in-memory
+	ErrorHandler HandlerFunc   // default responds 403
+}
+
+const csrfTokenKey = "gee.csrfToken"
+
+// CSRFProtect rejects unsafe requests (POST, PUT, PATCH, DELETE...) whose
+// token, taken from the header or the form field, doesn't match. The
+// token is available to handlers through CSRFToken and to templates
+// through the csrfToken and csrfField functions.
+func CSRFProtect(config CSRFConfig) HandlerFunc {
+	if config.CookieName == "" {
+		config.CookieName = "_csrf"
+	}
+	if config.HeaderName == "" {
+		config.HeaderName = "X-CSRF-Token"
+	}
+	if config.FormField == "" {
+		config.FormField = "csrf_token"
+	}
+	if config.CookiePath == "" {
+		config.CookiePath = "/"
+	}
+	if config.CookieMaxAge <= 0 {
+		config.CookieMaxAge = 12 * time.Hour
+	}
+	if config.SameSite == 0 {
+		config.SameSite = http.SameSiteLaxMode
+	}
+	if config.Mode == CSRFSynchronizer && config.Store == nil {
+		config.Store = NewMemoryCSRFStore()
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = func(c *Context) {
+			c.Fail(http.StatusForbidden, "invalid CSRF token")
+		}
+	}
+
+	return func(c *Context) {
+		expected := config.expectedToken(c)
+
+		if !isSafeMethod(c.Method) {
+			submitted := c.Req.Header.Get(config.HeaderName)
+			if submitted == "" {
+				submitted = c.PostForm(config.FormField)
+			}
+			if expected == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(expected)) != 1 {
+				c.Abort()
+				config.ErrorHandler(c)
+				return
+			}
+		}
+
+		if expected == "" {
+			expected = config.issueToken(c)
+		}
+		c.Set(csrfTokenKey, expected)
+		c.SetFunc("csrfToken", func() string { return expected })
+		c.SetFunc("csrfField", func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(config.FormField) +
+				`" value="` + template.HTMLEscapeString(expected) + `">`)
+		})
+		c.Next()
+	}
+}
+
+// CSRFToken return the CSRF token of the request, set by CSRFProtect
+func CSRFToken(c *Context) string {
+	token, _ := c.Keys[csrfTokenKey].(string)
+	return token
+}
+
+// expectedToken returns the token the request must carry, or an empty
+// string if the client has none yet
+func (config *CSRFConfig) expectedToken(c *Context) string {
+	cookie, err := c.Req.Cookie(config.CookieName)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+	if config.Mode == CSRFSynchronizer {
+		token, _ := config.Store.Token(cookie.Value)
+		return token
+	}
+	return cookie.Value
+}
+
+// issueToken generates a new token and sets the cookie carrying it, or
+// the session cookie in synchronizer mode
+func (config *CSRFConfig) issueToken(c *Context) string {
+	token := randomToken()
+	value := token
+	if config.Mode == CSRFSynchronizer {
+		value = randomToken()
+		if cookie, err := c.Req.Cookie(config.CookieName); err == nil && cookie.Value != "" {
+			value = cookie.Value // keep the existing session
+		}
+		config.Store.SetToken(value, token)
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     config.CookieName,
+		Value:    value,
+		Path:     config.CookiePath,
+		MaxAge:   int(config.CookieMaxAge.Seconds()),
+		Secure:   config.Secure,
+		HttpOnly: config.Mode == CSRFSynchronizer, // double submit cookies may be read by scripts
+		SameSite: config.SameSite,
+	})
+	return token
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// MemoryCSRFStore is an in-memory CSRFStore, entries expire after 12 hours
+type MemoryCSRFStore struct {
+	mu     sync.Mutex
+	tokens map[string]memoryCSRFToken
+}
+
+type memoryCSRFToken struct {
+	token  string
+	expire time.Time
+}
+
+var _ CSRFStore = (*MemoryCSRFStore)(nil)
+
+// NewMemoryCSRFStore creates a MemoryCSRFStore
+func NewMemoryCSRFStore() *MemoryCSRFStore {
+	return &MemoryCSRFStore{tokens: make(map[string]memoryCSRFToken)}
+}
+
+// Token implements CSRFStore
+func (s *MemoryCSRFStore) Token(sessionID string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tokens[sessionID]
+	if !ok || time.Now().After(t.expire) {
+		delete(s.tokens, sessionID)
+		return "", false
+	}
+	return t.token, true
+}
+
+// SetToken implements CSRFStore
+func (s *MemoryCSRFStore) SetToken(sessionID string, token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, t := range s.tokens { // drop expired sessions on the way
+		if now.After(t.expire) {
+			delete(s.tokens, id)
+		}
+	}
+	s.tokens[sessionID] = memoryCSRFToken{token: token, expire: now.Add(12 * time.Hour)}
+}
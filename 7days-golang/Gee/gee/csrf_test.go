@@ -0,0 +1,108 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRFProtect(t *testing.T) {
+	for _, mode := range []CSRFMode{CSRFDoubleSubmit, CSRFSynchronizer} {
+		r := New()
+		r.Use(CSRFProtect(CSRFConfig{Mode: mode}))
+		r.GET("/form", func(c *Context) {
+			c.String(http.StatusOK, CSRFToken(c))
+		})
+		r.POST("/form", func(c *Context) {
+			c.String(http.StatusOK, "posted")
+		})
+		serve := func(method, token string, cookie *http.Cookie, form bool) *httptest.ResponseRecorder {
+			var req *http.Request
+			if form {
+				req = httptest.NewRequest(method, "/form", strings.NewReader(url.Values{"csrf_token": {token}}.Encode()))
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				req = httptest.NewRequest(method, "/form", nil)
+				if token != "" {
+					req.Header.Set("X-CSRF-Token", token)
+				}
+			}
+			if cookie != nil {
+				req.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			return w
+		}
+
+		w := serve("GET", "", nil, false)
+		token, cookies := w.Body.String(), w.Result().Cookies()
+		if token == "" || len(cookies) != 1 {
+			t.Fatalf("mode %d: GET issued token %q, cookies %v", mode, token, cookies)
+		}
+		if httpOnly := cookies[0].HttpOnly; httpOnly != (mode == CSRFSynchronizer) {
+			t.Errorf("mode %d: HttpOnly = %v", mode, httpOnly)
+		}
+		if w := serve("GET", "", cookies[0], false); w.Body.String() != token {
+			t.Errorf("mode %d: the token changed to %q on the next GET", mode, w.Body)
+		}
+
+		tests := []struct {
+			name   string
+			token  string
+			cookie *http.Cookie
+			form   bool
+			code   int
+		}{
+			{"header", token, cookies[0], false, http.StatusOK},
+			{"form field", token, cookies[0], true, http.StatusOK},
+			{"no token", "", cookies[0], false, http.StatusForbidden},
+			{"wrong token", token + "x", cookies[0], false, http.StatusForbidden},
+			{"no cookie", token, nil, false, http.StatusForbidden},
+		}
+		for _, tt := range tests {
+			if w := serve("POST", tt.token, tt.cookie, tt.form); w.Code != tt.code {
+				t.Errorf("mode %d: POST with %s = %d, want %d", mode, tt.name, w.Code, tt.code)
+			}
+		}
+	}
+}
+
+func TestSecureHeaders(t *testing.T) {
+	r := New()
+	r.Use(SecureHeaders(DefaultSecureConfig()))
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, CSPNonce(c))
+	})
+	serve := func(https bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if https {
+			req.Header.Set("X-Forwarded-Proto", "https")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(false)
+	nonce, header := w.Body.String(), w.Header()
+	if nonce == "" || !strings.Contains(header.Get("Content-Security-Policy"), "'nonce-"+nonce+"'") {
+		t.Fatalf("nonce %q not in the CSP %q", nonce, header.Get("Content-Security-Policy"))
+	}
+	if header.Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS sent over HTTP")
+	}
+	if header.Get("X-Frame-Options") != "DENY" || header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("headers = %v", header)
+	}
+
+	w = serve(true)
+	if w.Body.String() == nonce {
+		t.Error("the nonce was reused")
+	}
+	if hsts := w.Header().Get("Strict-Transport-Security"); hsts != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Strict-Transport-Security = %q", hsts)
+	}
+}
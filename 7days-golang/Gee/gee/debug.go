@@ -0,0 +1,107 @@
+package gee
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Handler     string   `json:"handler"`
+	Middlewares []string `json:"middlewares"`
+}
+
+// Routes returns the registered routes sorted by path and method, along
+// with the middlewares applied to them
+func (engine *Engine) Routes() []RouteInfo {
+	r := engine.router.Load()
+	engine.mu.RLock()
+	defer engine.mu.RUnlock()
+
+	routes := make([]RouteInfo, 0, len(r.handlers))
+	for key, handler := range r.handlers {
+		method, pattern, _ := strings.Cut(key, "-")
+		info := RouteInfo{
+			Method:      method,
+			Path:        pattern,
+			Handler:     nameOfFunction(handler),
+			Middlewares: []string{},
+		}
+		for _, group := range engine.groups {
+			if strings.HasPrefix(pattern, group.prefix) {
+				for _, middleware := range group.middlewares {
+					info.Middlewares = append(info.Middlewares, nameOfFunction(middleware))
+				}
+			}
+		}
+		routes = append(routes, info)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// Debug registers a group of debugging routes under prefix:
+//
+//	GET <prefix>/routes          the route table as JSON
+//	GET <prefix>/vars            expvar
+//	GET <prefix>/pprof/          net/http/pprof index and profiles
+//
+// Protect the group with an authentication middleware, and avoid it in
+// production. A warning is logged if it's registered in ReleaseMode.
+func (group *RouterGroup) Debug(prefix string) *RouterGroup {
+	if Mode() == ReleaseMode {
+		log.Printf("[WARNING] debug routes registered under %q in release mode", group.prefix+prefix)
+	}
+
+	engine := group.engine
+	debug := group.Group(prefix)
+	debug.GET("/routes", func(c *Context) {
+		c.JSON(http.StatusOK, engine.Routes())
+	})
+	debug.GET("/vars", WrapH(expvar.Handler()))
+
+	// static routes go before the wildcard one, which would otherwise
+	// shadow them in the trie
+	debug.GET("/pprof", func(c *Context) {
+		if !strings.HasSuffix(c.Req.URL.Path, "/") {
+			// the index links to the profiles with relative URLs
+			http.Redirect(c.Writer, c.Req, c.Req.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		pprof.Index(c.Writer, c.Req)
+	})
+	debug.GET("/pprof/cmdline", WrapF(pprof.Cmdline))
+	debug.GET("/pprof/profile", WrapF(pprof.Profile))
+	debug.GET("/pprof/symbol", WrapF(pprof.Symbol))
+	debug.POST("/pprof/symbol", WrapF(pprof.Symbol))
+	debug.GET("/pprof/trace", WrapF(pprof.Trace))
+	debug.GET("/pprof/:name", func(c *Context) {
+		pprof.Handler(c.Param("name")).ServeHTTP(c.Writer, c.Req)
+	})
+	return debug
+}
+
+func nameOfFunction(f any) string {
+	if f == nil {
+		return ""
+	}
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return ""
+	}
+	return fn.Name()
+}
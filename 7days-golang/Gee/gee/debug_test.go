@@ -0,0 +1,69 @@
+package gee
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetMode(t *testing.T) {
+	defer SetMode(Mode())
+
+	for _, mode := range []string{ReleaseMode, TestMode, DebugMode} {
+		SetMode(mode)
+		if Mode() != mode || IsDebugging() != (mode == DebugMode) {
+			t.Errorf("SetMode(%q): Mode() = %q, IsDebugging() = %v", mode, Mode(), IsDebugging())
+		}
+	}
+	SetMode("")
+	if Mode() != DebugMode {
+		t.Errorf(`SetMode(""): Mode() = %q, want debug`, Mode())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("SetMode accepted an unknown mode")
+		}
+	}()
+	SetMode("verbose")
+}
+
+func TestDebugRoutes(t *testing.T) {
+	r := New()
+	r.Use(Logger())
+	r.GET("/hello/:name", func(c *Context) {})
+	r.Group("/admin").Debug("/debug")
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := serve("/admin/debug/routes")
+	var routes []RouteInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil {
+		t.Fatalf("GET /admin/debug/routes = %d %q: %v", w.Code, w.Body, err)
+	}
+	var hello *RouteInfo
+	for i := range routes {
+		if routes[i].Path == "/hello/:name" {
+			hello = &routes[i]
+		}
+	}
+	if hello == nil || hello.Method != "GET" || !strings.HasSuffix(hello.Handler, "TestDebugRoutes.func1") ||
+		len(hello.Middlewares) != 1 || !strings.Contains(hello.Middlewares[0], "Logger") {
+		t.Fatalf("/hello/:name route = %+v", hello)
+	}
+
+	if w := serve("/admin/debug/pprof"); w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/admin/debug/pprof/" {
+		t.Errorf("GET /admin/debug/pprof = %d, Location %q", w.Code, w.Header().Get("Location"))
+	}
+	for _, path := range []string{"/admin/debug/pprof/", "/admin/debug/pprof/goroutine", "/admin/debug/vars"} {
+		if w := serve(path); w.Code != http.StatusOK {
+			t.Errorf("GET %s = %d", path, w.Code)
+		}
+	}
+}
@@ -1,9 +1,13 @@
 package gee
 
 import (
+	"fmt"
 	"html/template"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // HandlerFunc defines the request handler function
@@ -12,18 +16,25 @@ type HandlerFunc func(*Context)
 // Engine is the instance of framework
 type Engine struct {
 	*RouterGroup
-	router *router
-	groups []*RouterGroup // store all groups
+	router   atomic.Pointer[router] // published route table, see UpdateRoutes
+	routerMu sync.Mutex             // serializes route table updates
+	serving  atomic.Bool            // set under routerMu by the first request
+	mu       sync.RWMutex           // guards groups and their middlewares
+	groups   []*RouterGroup         // store all groups
 	// HTML rendering
 	htmlTmpls *template.Template
+	htmlBase  *template.Template // never executed, cloned for per-request funcs
 	funcMap   template.FuncMap
+	// proxies whose X-Forwarded-For is believed by Context.ClientIP
+	trustedProxies []*net.IPNet
 }
 
 // Ensure that *Engine implements the interface
 var _ http.Handler = (*Engine)(nil)
 
 func New() *Engine {
-	engine := &Engine{router: newRouter()}
+	engine := &Engine{}
+	engine.router.Store(newRouter())
 	engine.RouterGroup = &RouterGroup{engine: engine}
 	engine.groups = []*RouterGroup{engine.RouterGroup}
 	return engine
@@ -37,22 +48,72 @@ func Default() *Engine {
 
 // Run start http server
 func (engine *Engine) Run(addr string) error {
+	debugPrintWARNING()
+	debugPrintf("Listening and serving HTTP on %s", addr)
 	return http.ListenAndServe(addr, engine)
 }
 
 // ServeHTTP conforms to http.Handler interface
 func (engine *Engine) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if !engine.serving.Load() {
+		// routes registered from now on go through a copy
+		engine.routerMu.Lock()
+		engine.serving.Store(true)
+		engine.routerMu.Unlock()
+	}
 	var middlewares []HandlerFunc
+	engine.mu.RLock()
 	for _, group := range engine.groups {
 		if strings.HasPrefix(req.URL.Path, group.prefix) {
 			middlewares = append(middlewares, group.middlewares...)
 		}
 	}
+	engine.mu.RUnlock()
 
 	c := newContext(w, req)
 	c.handlers = middlewares
 	c.engine = engine
-	engine.router.handle(c)
+	engine.router.Load().handle(c)
+}
+
+// SetTrustedProxies sets the proxies whose X-Forwarded-For and X-Real-Ip
+// headers are believed by Context.ClientIP, as IPs or CIDRs. None is
+// trusted by default. Call it before serving.
+func (engine *Engine) SetTrustedProxies(proxies ...string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("gee: invalid trusted proxy %q", proxy)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			proxy = fmt.Sprintf("%s/%d", proxy, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("gee: invalid trusted proxy %q: %w", proxy, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	engine.trustedProxies = nets
+	return nil
+}
+
+func (engine *Engine) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range engine.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
 
 func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
@@ -60,5 +121,18 @@ func (engine *Engine) SetFuncMap(funcMap template.FuncMap) {
 }
 
 func (engine *Engine) LoadHTMLGlob(pattern string) {
-	engine.htmlTmpls = template.Must(template.New("").Funcs(engine.funcMap).ParseGlob(pattern))
+	tmpls := template.New("").Funcs(builtinFuncs()).Funcs(engine.funcMap)
+	engine.htmlTmpls = template.Must(tmpls.ParseGlob(pattern))
+	engine.htmlBase = template.Must(engine.htmlTmpls.Clone())
+}
+
+// builtinFuncs are placeholders of the per-request template functions,
+// middlewares replace them with Context.SetFunc
+func builtinFuncs() template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string { return "" },
+		"csrfField": func() template.HTML { return "" },
+		"cspNonce":  func() string { return "" },
+		"T":         func(key string, args ...any) string { return key },
+	}
 }
@@ -0,0 +1,494 @@
+package gee
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// I18n holds the message catalogs of all locales and resolves the locale
+// of each request. Messages are fmt formats, a message with plural forms
+// picks the form by the first numeric argument:
+//
+//	{"hello": "Hello, %s", "apples": {"one": "%d apple", "other": "%d apples"}}
+type I18n struct {
+	DefaultLocale string
+	QueryKey      string // default "lang"
+	CookieName    string // default "lang"
+
+	mu       sync.RWMutex // guards catalogs
+	catalogs map[string]map[string]i18nMessage
+}
+
+// i18nMessage is a message, which has either a text or plural forms
+type i18nMessage struct {
+	text   string
+	plural map[string]string // CLDR plural category -> text
+}
+
+var pluralCategories = map[string]bool{
+	"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true,
+}
+
+const localeKey = "gee.locale"
+
+// NewI18n creates an I18n falling back to defaultLocale
+func NewI18n(defaultLocale string) *I18n {
+	return &I18n{
+		DefaultLocale: normalizeLocale(defaultLocale),
+		QueryKey:      "lang",
+		CookieName:    "lang",
+		catalogs:      make(map[string]map[string]i18nMessage),
+	}
+}
+
+// LoadJSON adds the messages of a JSON catalog to locale. Nested objects
+// whose keys aren't plural categories are flattened into dotted keys.
+func (i *I18n) LoadJSON(locale string, data []byte) error {
+	var tree map[string]any
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return fmt.Errorf("i18n: parse %s catalog: %v", locale, err)
+	}
+	return i.load(locale, tree)
+}
+
+// LoadTOML adds the messages of a TOML catalog to locale. Only the subset
+// of TOML needed by catalogs is supported: comments, tables and string
+// values.
+func (i *I18n) LoadTOML(locale string, data []byte) error {
+	tree, err := parseTOML(string(data))
+	if err != nil {
+		return fmt.Errorf("i18n: parse %s catalog: %v", locale, err)
+	}
+	return i.load(locale, tree)
+}
+
+// LoadGlob loads the catalogs matching pattern, the locale is taken from
+// the file name and the format from the extension, e.g. locales/zh-CN.toml
+func (i *I18n) LoadGlob(pattern string) error {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		ext := filepath.Ext(file)
+		locale := strings.TrimSuffix(filepath.Base(file), ext)
+		switch strings.ToLower(ext) {
+		case ".json":
+			err = i.LoadJSON(locale, data)
+		case ".toml":
+			err = i.LoadTOML(locale, data)
+		default:
+			err = fmt.Errorf("i18n: unknown catalog format: %s", file)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *I18n) load(locale string, tree map[string]any) error {
+	messages := make(map[string]i18nMessage)
+	if err := flattenMessages("", tree, messages); err != nil {
+		return fmt.Errorf("i18n: %s catalog: %v", locale, err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	locale = normalizeLocale(locale)
+	catalog, ok := i.catalogs[locale]
+	if !ok {
+		catalog = make(map[string]i18nMessage)
+		i.catalogs[locale] = catalog
+	}
+	for key, msg := range messages {
+		catalog[key] = msg
+	}
+	return nil
+}
+
+func flattenMessages(prefix string, tree map[string]any, messages map[string]i18nMessage) error {
+	for key, value := range tree {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch v := value.(type) {
+		case string:
+			messages[key] = i18nMessage{text: v}
+		case map[string]any:
+			if plural, ok := pluralForms(v); ok {
+				messages[key] = i18nMessage{plural: plural}
+			} else if err := flattenMessages(key, v, messages); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("message %q is neither a string nor a table", key)
+		}
+	}
+	return nil
+}
+
+// pluralForms returns the forms if all keys of table are plural categories
+func pluralForms(table map[string]any) (map[string]string, bool) {
+	forms := make(map[string]string, len(table))
+	for category, value := range table {
+		text, ok := value.(string)
+		if !ok || !pluralCategories[category] {
+			return nil, false
+		}
+		forms[category] = text
+	}
+	return forms, len(forms) > 0
+}
+
+// Translate formats the message key in locale, falling back to the base
+// language, then to the default locale, and finally to the key itself
+func (i *I18n) Translate(locale string, key string, args ...any) string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	for _, candidate := range []string{normalizeLocale(locale), baseLanguage(locale), i.DefaultLocale, baseLanguage(i.DefaultLocale)} {
+		msg, ok := i.catalogs[candidate][key]
+		if !ok {
+			continue
+		}
+		text := msg.text
+		if msg.plural != nil {
+			text = msg.plural[pluralRule(candidate)(pluralCount(args))]
+			if text == "" {
+				text = msg.plural["other"]
+			}
+		}
+		if len(args) == 0 || !strings.Contains(text, "%") {
+			return text
+		}
+		return fmt.Sprintf(text, args...)
+	}
+	return key
+}
+
+// Middleware resolves the locale of the request from the query, the
+// cookie or the Accept-Language header, in this order, and provides the
+// T template function
+func (i *I18n) Middleware() HandlerFunc {
+	return func(c *Context) {
+		locale := i.resolve(c)
+		c.Set(localeKey, locale)
+		c.SetHeader("Content-Language", locale)
+		c.SetFunc("T", func(key string, args ...any) string {
+			return i.Translate(locale, key, args...)
+		})
+		c.Set(i18nKey, i)
+		c.Next()
+	}
+}
+
+const i18nKey = "gee.i18n"
+
+func (i *I18n) resolve(c *Context) string {
+	if lang := c.Query(i.QueryKey); lang != "" {
+		if locale, ok := i.match(lang); ok {
+			return locale
+		}
+	}
+	if cookie, err := c.Req.Cookie(i.CookieName); err == nil {
+		if locale, ok := i.match(cookie.Value); ok {
+			return locale
+		}
+	}
+	for _, lang := range parseAcceptLanguage(c.Req.Header.Get("Accept-Language")) {
+		if lang == "*" {
+			break
+		}
+		if locale, ok := i.match(lang); ok {
+			return locale
+		}
+	}
+	return i.DefaultLocale
+}
+
+// match returns the loaded locale best matching lang
+func (i *I18n) match(lang string) (string, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	lang = normalizeLocale(lang)
+	if _, ok := i.catalogs[lang]; ok {
+		return lang, true
+	}
+	if base := baseLanguage(lang); base != lang {
+		if _, ok := i.catalogs[base]; ok {
+			return base, true
+		}
+	}
+	return "", false
+}
+
+// Locale return the locale resolved by the I18n middleware
+func (c *Context) Locale() string {
+	locale, _ := c.Keys[localeKey].(string)
+	return locale
+}
+
+// T return the message key translated into the locale of the request,
+// or the key itself if the I18n middleware isn't used
+func (c *Context) T(key string, args ...any) string {
+	i, ok := c.Keys[i18nKey].(*I18n)
+	if !ok {
+		return key
+	}
+	return i.Translate(c.Locale(), key, args...)
+}
+
+// parseAcceptLanguage returns the language tags by descending quality
+func parseAcceptLanguage(header string) []string {
+	type tag struct {
+		lang string
+		q    float64
+	}
+	var tags []tag
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if lang = strings.TrimSpace(lang); lang == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			tags = append(tags, tag{lang, q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	langs := make([]string, len(tags))
+	for i, t := range tags {
+		langs[i] = t.lang
+	}
+	return langs
+}
+
+// normalizeLocale turns zh_cn or ZH-cn into zh-CN
+func normalizeLocale(locale string) string {
+	parts := strings.Split(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"), "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i]) // region
+		} else if len(parts[i]) == 4 {
+			parts[i] = strings.ToUpper(parts[i][:1]) + strings.ToLower(parts[i][1:]) // script
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+func baseLanguage(locale string) string {
+	base, _, _ := strings.Cut(normalizeLocale(locale), "-")
+	return base
+}
+
+// pluralCount returns the first numeric argument, used to pick the
+// plural form
+func pluralCount(args []any) int64 {
+	for _, arg := range args {
+		switch n := arg.(type) {
+		case int:
+			return int64(n)
+		case int8:
+			return int64(n)
+		case int16:
+			return int64(n)
+		case int32:
+			return int64(n)
+		case int64:
+			return n
+		case uint:
+			return int64(n)
+		case uint8:
+			return int64(n)
+		case uint16:
+			return int64(n)
+		case uint32:
+			return int64(n)
+		case uint64:
+			return int64(n)
+		case float32:
+			return int64(n)
+		case float64:
+			return int64(n)
+		}
+	}
+	return 0
+}
+
+// pluralRule returns the CLDR plural rule of the language, for integers
+func pluralRule(locale string) func(n int64) string {
+	switch baseLanguage(locale) {
+	case "ja", "zh", "ko", "vi", "th", "id", "ms":
+		return func(int64) string { return "other" }
+	case "fr", "pt":
+		return func(n int64) string {
+			if n == 0 || n == 1 {
+				return "one"
+			}
+			return "other"
+		}
+	case "ru", "uk", "be":
+		return func(n int64) string {
+			switch mod10, mod100 := n%10, n%100; {
+			case mod10 == 1 && mod100 != 11:
+				return "one"
+			case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+				return "few"
+			}
+			return "many"
+		}
+	case "pl":
+		return func(n int64) string {
+			switch mod10, mod100 := n%10, n%100; {
+			case n == 1:
+				return "one"
+			case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+				return "few"
+			}
+			return "many"
+		}
+	case "cs", "sk":
+		return func(n int64) string {
+			switch {
+			case n == 1:
+				return "one"
+			case n >= 2 && n <= 4:
+				return "few"
+			}
+			return "other"
+		}
+	case "ar":
+		return func(n int64) string {
+			switch mod100 := n % 100; {
+			case n == 0:
+				return "zero"
+			case n == 1:
+				return "one"
+			case n == 2:
+				return "two"
+			case mod100 >= 3 && mod100 <= 10:
+				return "few"
+			case mod100 >= 11:
+				return "many"
+			}
+			return "other"
+		}
+	}
+	return func(n int64) string {
+		if n == 1 {
+			return "one"
+		}
+		return "other"
+	}
+}
+
+// parseTOML parses the TOML subset used by catalogs into a tree of
+// map[string]any and string values
+func parseTOML(data string) (map[string]any, error) {
+	root := make(map[string]any)
+	table := root
+
+	for lineNo, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(stripTOMLComment(line))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: invalid table header", lineNo+1)
+			}
+			table = root
+			for _, name := range strings.Split(line[1:len(line)-1], ".") {
+				name, err := unquoteTOMLKey(name)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", lineNo+1, err)
+				}
+				sub, ok := table[name].(map[string]any)
+				if !ok {
+					if _, exists := table[name]; exists {
+						return nil, fmt.Errorf("line %d: %q is not a table", lineNo+1, name)
+					}
+					sub = make(map[string]any)
+					table[name] = sub
+				}
+				table = sub
+			}
+			continue
+		}
+
+		rawKey, rawValue, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNo+1)
+		}
+		key, err := unquoteTOMLKey(rawKey)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo+1, err)
+		}
+		value, err := unquoteTOMLString(strings.TrimSpace(rawValue))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo+1, err)
+		}
+		table[key] = value
+	}
+	return root, nil
+}
+
+// stripTOMLComment removes a trailing comment, ignoring # inside strings
+func stripTOMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote == 0 && c == '#':
+			return line[:i]
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == '"' && c == '\\':
+			i++
+		case c == quote:
+			quote = 0
+		}
+	}
+	return line
+}
+
+func unquoteTOMLKey(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if strings.HasPrefix(key, `"`) || strings.HasPrefix(key, "'") {
+		return unquoteTOMLString(key)
+	}
+	if key == "" {
+		return "", fmt.Errorf("empty key")
+	}
+	return key, nil
+}
+
+func unquoteTOMLString(s string) (string, error) {
+	switch {
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return s[1 : len(s)-1], nil // literal string, no escapes
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		return strconv.Unquote(s)
+	}
+	return "", fmt.Errorf("expected a string, got %s", s)
+}
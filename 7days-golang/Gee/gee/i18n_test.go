@@ -0,0 +1,134 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	got, err := parseTOML(`
+# greetings
+hello = "Hello, %s" # trailing comment
+'quoted.key' = 'C:\path # not a comment'
+
+[apples]
+one = "%d apple"
+other = "%d apples"
+
+[errors."not found"]
+page = "Page \"%s\" not found\n"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"hello":      "Hello, %s",
+		"quoted.key": `C:\path # not a comment`,
+		"apples":     map[string]any{"one": "%d apple", "other": "%d apples"},
+		"errors":     map[string]any{"not found": map[string]any{"page": "Page \"%s\" not found\n"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseTOML = %v, want %v", got, want)
+	}
+
+	for _, data := range []string{
+		"hello",
+		"hello = 42",
+		"hello = \"unterminated",
+		"[[array]]",
+		"[table",
+		"a = \"x\"\n[a]",
+		" = \"x\"",
+	} {
+		if _, err := parseTOML(data); err == nil {
+			t.Errorf("parseTOML(%q) succeeded", data)
+		}
+	}
+}
+
+func TestPluralRule(t *testing.T) {
+	tests := map[string][]string{
+		// n = 0, 1, 2, 5, 11, 21, 22, 101
+		"en":    {"other", "one", "other", "other", "other", "other", "other", "other"},
+		"fr-CA": {"one", "one", "other", "other", "other", "other", "other", "other"},
+		"zh":    {"other", "other", "other", "other", "other", "other", "other", "other"},
+		"ru":    {"many", "one", "few", "many", "many", "one", "few", "one"},
+		"pl":    {"many", "one", "few", "many", "many", "many", "few", "many"},
+		"cs":    {"other", "one", "few", "other", "other", "other", "other", "other"},
+		"ar":    {"zero", "one", "two", "few", "many", "many", "many", "other"},
+	}
+	for locale, want := range tests {
+		rule := pluralRule(locale)
+		for i, n := range []int64{0, 1, 2, 5, 11, 21, 22, 101} {
+			if got := rule(n); got != want[i] {
+				t.Errorf("pluralRule(%q)(%d) = %s, want %s", locale, n, got, want[i])
+			}
+		}
+	}
+}
+
+func TestI18n(t *testing.T) {
+	i := NewI18n("en")
+	if err := i.LoadJSON("en", []byte(`{"hello": "Hello, %s", "apples": {"one": "%d apple", "other": "%d apples"}, "nav": {"home": "Home"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.LoadTOML("ru", []byte("[apples]\none = \"%d яблоко\"\nfew = \"%d яблока\"\nmany = \"%d яблок\"\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.LoadJSON("fr_fr", []byte(`{"hello": "Bonjour, %s"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	translations := []struct {
+		locale, key string
+		args        []any
+		want        string
+	}{
+		{"en", "hello", []any{"Tom"}, "Hello, Tom"},
+		{"en", "apples", []any{1}, "1 apple"},
+		{"en", "apples", []any{3}, "3 apples"},
+		{"en", "nav.home", nil, "Home"},
+		{"ru", "apples", []any{22}, "22 яблока"},
+		{"ru", "hello", []any{"Tom"}, "Hello, Tom"}, // default locale
+		{"fr-FR", "hello", []any{"Tom"}, "Bonjour, Tom"},
+		{"en", "missing", nil, "missing"},
+	}
+	for _, tt := range translations {
+		if got := i.Translate(tt.locale, tt.key, tt.args...); got != tt.want {
+			t.Errorf("Translate(%q, %q, %v) = %q, want %q", tt.locale, tt.key, tt.args, got, tt.want)
+		}
+	}
+
+	r := New()
+	r.Use(i.Middleware())
+	r.GET("/", func(c *Context) {
+		c.String(http.StatusOK, c.T("hello", "Tom"))
+	})
+	requests := []struct {
+		query, cookie, accept, want string
+	}{
+		{"", "", "", "en"},
+		{"", "", "de-DE, ru;q=0.8, fr-FR;q=0.9", "fr-FR"},
+		{"", "", "de-DE, ru-RU;q=0.8, fr;q=0.9", "ru"},
+		{"", "", "de, *;q=0.5", "en"},
+		{"", "ru", "fr", "ru"},
+		{"ru_RU", "fr", "fr", "ru"},
+		{"de", "", "fr-FR", "fr-FR"},
+	}
+	for _, tt := range requests {
+		req := httptest.NewRequest("GET", "/?lang="+tt.query, nil)
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "lang", Value: tt.cookie})
+		}
+		if tt.accept != "" {
+			req.Header.Set("Accept-Language", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got := w.Header().Get("Content-Language"); got != tt.want {
+			t.Errorf("lang %q, cookie %q, Accept-Language %q: locale %q, want %q", tt.query, tt.cookie, tt.accept, got, tt.want)
+		}
+	}
+}
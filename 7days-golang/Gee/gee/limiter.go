@@ -0,0 +1,222 @@
+package gee
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LimiterMode selects how a ConcurrencyLimiter adjusts its limit
+type LimiterMode int
+
+const (
+	// LimitFixed never changes the limit
+	LimitFixed LimiterMode = iota
+	// LimitAIMD increases the limit by one on fast responses and
+	// multiplies it by BackoffRatio on slow or overloaded ones
+	LimitAIMD
+	// LimitGradient compares the short term latency with a long term
+	// average and scales the limit by their ratio
+	LimitGradient
+)
+
+// Priority of a route, low priority routes are shed first
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityCritical
+)
+
+// share of the limit available to each priority
+var priorityShares = map[Priority]float64{
+	PriorityLow:      0.5,
+	PriorityNormal:   0.9,
+	PriorityCritical: 1,
+}
+
+// LimiterConfig configures a ConcurrencyLimiter
+type LimiterConfig struct {
+	Mode LimiterMode
+	// MaxInFlight is the fixed limit, or the initial one of the adaptive
+	// modes, defaults to 100
+	MaxInFlight int
+	// MinLimit and MaxLimit bound the adaptive limit, default to 1 and
+	// 10 * MaxInFlight
+	MinLimit int
+	MaxLimit int
+	// LatencyThreshold makes AIMD back off on slower responses,
+	// defaults to 500ms
+	LatencyThreshold time.Duration
+	// BackoffRatio is the AIMD multiplicative decrease, defaults to 0.9
+	BackoffRatio float64
+	// Tolerance is how much the gradient mode lets the latency grow
+	// before it shrinks the limit, defaults to 1.5
+	Tolerance float64
+	// Priorities maps route patterns to priorities, other routes are
+	// PriorityNormal
+	Priorities map[string]Priority
+	// RetryAfter is sent with rejected requests, defaults to 1s
+	RetryAfter time.Duration
+}
+
+// ConcurrencyLimiter bounds the number of requests served at once and
+// rejects the others with 503 Service Unavailable
+type ConcurrencyLimiter struct {
+	cfg LimiterConfig
+
+	mu       sync.Mutex
+	limit    float64
+	inFlight int
+	rejected uint64
+	longRTT  float64 // gradient mode, exponential average in seconds
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter
+func NewConcurrencyLimiter(cfg LimiterConfig) *ConcurrencyLimiter {
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = 100
+	}
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = 10 * cfg.MaxInFlight
+	}
+	if cfg.LatencyThreshold <= 0 {
+		cfg.LatencyThreshold = 500 * time.Millisecond
+	}
+	if cfg.BackoffRatio <= 0 || cfg.BackoffRatio >= 1 {
+		cfg.BackoffRatio = 0.9
+	}
+	if cfg.Tolerance < 1 {
+		cfg.Tolerance = 1.5
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	return &ConcurrencyLimiter{cfg: cfg, limit: float64(cfg.MaxInFlight)}
+}
+
+// Middleware admits a request if the in-flight requests are below the
+// share of the limit granted to its route priority
+func (l *ConcurrencyLimiter) Middleware() HandlerFunc {
+	return func(c *Context) {
+		priority, ok := l.cfg.Priorities[c.FullPath()]
+		if !ok {
+			priority = PriorityNormal
+		}
+		if !l.acquire(priority) {
+			seconds := int(math.Ceil(l.cfg.RetryAfter.Seconds()))
+			c.SetHeader("Retry-After", strconv.Itoa(seconds))
+			c.Fail(http.StatusServiceUnavailable, "Service Unavailable")
+			return
+		}
+
+		start := time.Now()
+		defer func() {
+			l.release(time.Since(start), c.writer.Status())
+		}()
+		c.Next()
+	}
+}
+
+func (l *ConcurrencyLimiter) acquire(priority Priority) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	allowed := int(l.limit * priorityShares[priority])
+	if allowed < 1 {
+		allowed = 1
+	}
+	if l.inFlight >= allowed {
+		l.rejected++
+		return false
+	}
+	l.inFlight++
+	return true
+}
+
+func (l *ConcurrencyLimiter) release(rtt time.Duration, status int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inFlight := l.inFlight
+	l.inFlight--
+	// 503 and 504 from downstream mean overload, other errors don't
+	overloaded := status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+
+	switch l.cfg.Mode {
+	case LimitAIMD:
+		if overloaded || rtt > l.cfg.LatencyThreshold {
+			l.limit *= l.cfg.BackoffRatio
+		} else if float64(inFlight)*2 >= l.limit {
+			// only grow when the limit is actually in use
+			l.limit++
+		}
+	case LimitGradient:
+		l.updateGradient(rtt.Seconds(), overloaded)
+	default:
+		return
+	}
+	l.limit = math.Max(float64(l.cfg.MinLimit), math.Min(float64(l.cfg.MaxLimit), l.limit))
+}
+
+// updateGradient follows the gradient2 algorithm of Netflix's
+// concurrency-limits
+func (l *ConcurrencyLimiter) updateGradient(rtt float64, overloaded bool) {
+	const window, smoothing = 600, 0.2
+
+	if l.longRTT == 0 {
+		l.longRTT = rtt
+	}
+	l.longRTT += (rtt - l.longRTT) / window
+	// let the average recover quickly once the latency drops
+	if l.longRTT/rtt > 2 {
+		l.longRTT *= 0.95
+	}
+
+	gradient := 0.5
+	if !overloaded && rtt > 0 {
+		gradient = math.Max(0.5, math.Min(1, l.cfg.Tolerance*l.longRTT/rtt))
+	}
+	next := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.limit*(1-smoothing) + next*smoothing
+}
+
+// Limit returns the current limit
+func (l *ConcurrencyLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// InFlight returns the number of admitted requests being served
+func (l *ConcurrencyLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Rejected returns the number of rejected requests
+func (l *ConcurrencyLimiter) Rejected() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rejected
+}
+
+// Register exports the limiter state through m
+func (l *ConcurrencyLimiter) Register(m *Metrics) {
+	m.GaugeFunc("concurrency_limit", "Current concurrency limit.", func() float64 {
+		return float64(l.Limit())
+	})
+	m.GaugeFunc("concurrency_in_flight", "Requests admitted by the concurrency limiter.", func() float64 {
+		return float64(l.InFlight())
+	})
+	m.CounterFunc("concurrency_rejected_total", "Requests rejected by the concurrency limiter.", func() float64 {
+		return float64(l.Rejected())
+	})
+}
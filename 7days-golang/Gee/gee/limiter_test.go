@@ -0,0 +1,119 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLimiterPriorities(t *testing.T) {
+	l := NewConcurrencyLimiter(LimiterConfig{MaxInFlight: 10})
+	for _, tt := range []struct {
+		priority Priority
+		admitted int
+	}{{PriorityLow, 5}, {PriorityNormal, 9}, {PriorityCritical, 10}} {
+		n := 0
+		for l.acquire(tt.priority) {
+			n++
+		}
+		if n != tt.admitted {
+			t.Errorf("priority %d admitted %d requests, want %d", tt.priority, n, tt.admitted)
+		}
+		for ; n > 0; n-- {
+			l.release(time.Millisecond, http.StatusOK)
+		}
+	}
+	if l.Limit() != 10 || l.Rejected() != 3 {
+		t.Errorf("fixed limiter: limit %d, rejected %d", l.Limit(), l.Rejected())
+	}
+}
+
+func TestLimiterAIMD(t *testing.T) {
+	l := NewConcurrencyLimiter(LimiterConfig{Mode: LimitAIMD, MaxInFlight: 10, MaxLimit: 12, LatencyThreshold: 100 * time.Millisecond})
+	serve := func(inFlight int, rtt time.Duration, status int) int {
+		for i := 0; i < inFlight; i++ {
+			l.acquire(PriorityCritical)
+		}
+		for i := 0; i < inFlight; i++ {
+			l.release(rtt, status)
+		}
+		return l.Limit()
+	}
+
+	if got := serve(1, time.Millisecond, 200); got != 10 {
+		t.Errorf("limit grew to %d while mostly unused", got)
+	}
+	if got := serve(10, time.Millisecond, 200); got != 12 {
+		t.Errorf("limit = %d after fast responses, want the maximum 12", got)
+	}
+	if got := serve(1, time.Second, 200); got != 10 {
+		t.Errorf("limit = %d after a slow response, want 12 * 0.9", got)
+	}
+	if got := serve(1, time.Millisecond, http.StatusServiceUnavailable); got != 9 {
+		t.Errorf("limit = %d after a 503, want 10.8 * 0.9", got)
+	}
+	if got := serve(1, time.Millisecond, http.StatusInternalServerError); got != 9 {
+		t.Errorf("limit = %d after a 500, want it unchanged", got)
+	}
+}
+
+func TestLimiterGradient(t *testing.T) {
+	l := NewConcurrencyLimiter(LimiterConfig{Mode: LimitGradient, MaxInFlight: 20, MinLimit: 5})
+	serve := func(n int, rtt time.Duration, status int) int {
+		for i := 0; i < n; i++ {
+			l.acquire(PriorityCritical)
+			l.release(rtt, status)
+		}
+		return l.Limit()
+	}
+
+	steady := serve(50, 10*time.Millisecond, 200)
+	if steady <= 20 {
+		t.Errorf("limit = %d under a steady latency, want it grown", steady)
+	}
+	if slow := serve(50, 100*time.Millisecond, 200); slow >= steady {
+		t.Errorf("limit = %d after the latency rose, want below %d", slow, steady)
+	}
+	if got := serve(200, 100*time.Millisecond, http.StatusServiceUnavailable); got != 5 {
+		t.Errorf("limit = %d while overloaded, want the minimum 5", got)
+	}
+}
+
+func TestLimiterMiddleware(t *testing.T) {
+	l := NewConcurrencyLimiter(LimiterConfig{
+		MaxInFlight: 2,
+		Priorities:  map[string]Priority{"/report": PriorityLow},
+		RetryAfter:  1500 * time.Millisecond,
+	})
+	entered, release := make(chan struct{}), make(chan struct{})
+	r := New()
+	r.Use(l.Middleware())
+	r.GET("/slow", func(c *Context) {
+		entered <- struct{}{}
+		<-release
+	})
+	r.GET("/report", func(c *Context) {})
+
+	done := make(chan struct{})
+	go func() {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+		close(done)
+	}()
+	<-entered
+
+	// a single request in flight uses the whole share of low priority
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/report", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("GET /report = %d, Retry-After %q, want 503 after 2s", w.Code, w.Header().Get("Retry-After"))
+	}
+	close(release)
+	<-done
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/report", nil))
+	if w.Code != http.StatusOK || l.InFlight() != 0 {
+		t.Errorf("GET /report = %d with %d in flight, want 200", w.Code, l.InFlight())
+	}
+}
@@ -9,6 +9,8 @@ func Logger() HandlerFunc {
 	return func(c *Context) {
 		start := time.Now()
 		c.Next()
-		log.Printf("[%d] %s in %vms", c.StatusCode, c.Req.RequestURI, time.Since(start).Milliseconds())
+		// the writer sees the status of responses not sent through c.Status,
+		// e.g. by http.ServeContent
+		log.Printf("[%d] %s in %vms", c.writer.Status(), c.Req.RequestURI, time.Since(start).Milliseconds())
 	}
 }
@@ -0,0 +1,222 @@
+package gee
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are the default latency histogram buckets in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics collects request counters, latency histograms and the number
+// of in-flight requests, and exposes them in Prometheus text format
+type Metrics struct {
+	namespace string
+	buckets   []float64
+	inFlight  int64
+
+	mu     sync.Mutex // guards series and funcs
+	series map[metricLabels]*metricSeries
+	funcs  []metricFunc
+}
+
+// metricFunc is a metric whose value is read when exposed
+type metricFunc struct {
+	name, typ, help string
+	fn              func() float64
+}
+
+// metricLabels identifies a series by method, route pattern and status
+type metricLabels struct {
+	method string
+	route  string
+	status string
+}
+
+type metricSeries struct {
+	count   uint64
+	sum     float64
+	buckets []uint64 // cumulative counts, one per bucket
+}
+
+// NewMetrics creates a Metrics instance, the metric names are prefixed
+// with namespace, which defaults to "gee"
+func NewMetrics(namespace string, buckets ...float64) *Metrics {
+	if namespace == "" {
+		namespace = "gee"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &Metrics{
+		namespace: namespace,
+		buckets:   buckets,
+		series:    make(map[metricLabels]*metricSeries),
+	}
+}
+
+// Middleware records every request passing through the handler chain
+func (m *Metrics) Middleware() HandlerFunc {
+	return func(c *Context) {
+		start := time.Now()
+		atomic.AddInt64(&m.inFlight, 1)
+		defer atomic.AddInt64(&m.inFlight, -1)
+
+		defer func() {
+			status := c.writer.Status()
+			err := recover()
+			if err != nil && !c.Written() {
+				// an outer Recovery responds with a 500
+				status = http.StatusInternalServerError
+			}
+			m.observe(metricLabels{
+				method: c.Method,
+				route:  c.FullPath(),
+				status: strconv.Itoa(status),
+			}, time.Since(start).Seconds())
+			if err != nil {
+				panic(err)
+			}
+		}()
+		c.Next()
+	}
+}
+
+// Handler serves the collected metrics, mount it on any RouterGroup:
+//
+//	r.GET("/metrics", m.Handler())
+func (m *Metrics) Handler() HandlerFunc {
+	return func(c *Context) {
+		c.SetHeader("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		c.Status(http.StatusOK)
+		m.WriteTo(c.Writer)
+	}
+}
+
+// GaugeFunc exposes the value returned by fn as a gauge, the name is
+// prefixed with the namespace
+func (m *Metrics) GaugeFunc(name, help string, fn func() float64) {
+	m.addFunc(name, "gauge", help, fn)
+}
+
+// CounterFunc exposes the value returned by fn as a counter, the name is
+// prefixed with the namespace
+func (m *Metrics) CounterFunc(name, help string, fn func() float64) {
+	m.addFunc(name, "counter", help, fn)
+}
+
+func (m *Metrics) addFunc(name, typ, help string, fn func() float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.funcs = append(m.funcs, metricFunc{name: m.namespace + "_" + name, typ: typ, help: help, fn: fn})
+}
+
+func (m *Metrics) observe(labels metricLabels, seconds float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.series[labels]
+	if !ok {
+		s = &metricSeries{buckets: make([]uint64, len(m.buckets))}
+		m.series[labels] = s
+	}
+	s.count++
+	s.sum += seconds
+	for i, upper := range m.buckets {
+		if seconds <= upper {
+			s.buckets[i]++
+		}
+	}
+}
+
+// WriteTo writes the metrics in Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var sb strings.Builder
+
+	m.mu.Lock()
+	keys := make([]metricLabels, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+
+	name := m.namespace + "_http_requests_total"
+	writeMetricHeader(&sb, name, "counter", "Total number of HTTP requests.")
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%s{%s} %d\n", name, k.String(), m.series[k].count)
+	}
+
+	name = m.namespace + "_http_request_duration_seconds"
+	writeMetricHeader(&sb, name, "histogram", "HTTP request latencies in seconds.")
+	for _, k := range keys {
+		s, labels := m.series[k], k.String()
+		for i, upper := range m.buckets {
+			fmt.Fprintf(&sb, "%s_bucket{%s,le=%q} %d\n", name, labels, formatFloat(upper), s.buckets[i])
+		}
+		fmt.Fprintf(&sb, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, s.count)
+		fmt.Fprintf(&sb, "%s_sum{%s} %s\n", name, labels, formatFloat(s.sum))
+		fmt.Fprintf(&sb, "%s_count{%s} %d\n", name, labels, s.count)
+	}
+	funcs := append([]metricFunc(nil), m.funcs...)
+	m.mu.Unlock()
+
+	name = m.namespace + "_http_requests_in_flight"
+	writeMetricHeader(&sb, name, "gauge", "Number of HTTP requests currently being served.")
+	fmt.Fprintf(&sb, "%s %d\n", name, atomic.LoadInt64(&m.inFlight))
+
+	for _, f := range funcs {
+		writeMetricHeader(&sb, f.name, f.typ, f.help)
+		fmt.Fprintf(&sb, "%s %s\n", f.name, formatFloat(f.fn()))
+	}
+
+	n, err := io.WriteString(w, sb.String())
+	return int64(n), err
+}
+
+func (l metricLabels) String() string {
+	return fmt.Sprintf(`method="%s",route="%s",status="%s"`,
+		escapeLabel(l.method), escapeLabel(l.route), escapeLabel(l.status))
+}
+
+func writeMetricHeader(sb *strings.Builder, name, typ, help string) {
+	fmt.Fprintf(sb, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(sb, "# TYPE %s %s\n", name, typ)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,56 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics("test", 0.5, 0.1)
+	m.GaugeFunc("answer", "The answer.", func() float64 { return 42 })
+	r := New()
+	r.Use(Recovery(), m.Middleware())
+	r.GET("/hello/:name", func(c *Context) {
+		c.String(http.StatusOK, "hello %s", c.Param("name"))
+	})
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+	r.GET("/metrics", m.Handler())
+
+	for _, path := range []string{"/hello/alice", "/hello/bob", "/missing", "/panic"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+
+	for _, want := range []string{
+		"# TYPE test_http_requests_total counter\n",
+		`test_http_requests_total{method="GET",route="/hello/:name",status="200"} 2` + "\n",
+		`test_http_requests_total{method="GET",route="",status="404"} 1` + "\n",
+		`test_http_requests_total{method="GET",route="/panic",status="500"} 1` + "\n",
+		`test_http_request_duration_seconds_bucket{method="GET",route="/hello/:name",status="200",le="0.1"} 2` + "\n",
+		`test_http_request_duration_seconds_bucket{method="GET",route="/hello/:name",status="200",le="+Inf"} 2` + "\n",
+		`test_http_request_duration_seconds_count{method="GET",route="/hello/:name",status="200"} 2` + "\n",
+		// the scrape itself is in flight
+		"test_http_requests_in_flight 1\n",
+		"# TYPE test_answer gauge\ntest_answer 42\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+	// buckets are sorted
+	if strings.Index(body, `le="0.1"`) > strings.Index(body, `le="0.5"`) {
+		t.Errorf("buckets out of order:\n%s", body)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("escapeLabel = %s", got)
+	}
+}
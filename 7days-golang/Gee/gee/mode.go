@@ -0,0 +1,59 @@
+package gee
+
+import (
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+// EnvGeeMode is the environment variable setting the initial mode
+const EnvGeeMode = "GEE_MODE"
+
+const (
+	// DebugMode logs route registration and other framework internals
+	DebugMode = "debug"
+	// ReleaseMode keeps the framework quiet, use it in production
+	ReleaseMode = "release"
+	// TestMode is like ReleaseMode, for tests
+	TestMode = "test"
+)
+
+var geeMode atomic.Value
+
+func init() {
+	SetMode(os.Getenv(EnvGeeMode))
+}
+
+// SetMode sets the framework mode, an empty value means DebugMode
+func SetMode(value string) {
+	switch value {
+	case "":
+		value = DebugMode
+	case DebugMode, ReleaseMode, TestMode:
+	default:
+		panic("gee mode unknown: " + value + " (available modes: debug, release, test)")
+	}
+	geeMode.Store(value)
+}
+
+// Mode returns the current framework mode
+func Mode() string {
+	return geeMode.Load().(string)
+}
+
+// IsDebugging reports whether the framework runs in DebugMode
+func IsDebugging() bool {
+	return Mode() == DebugMode
+}
+
+func debugPrintf(format string, values ...any) {
+	if IsDebugging() {
+		log.Printf("[GEE-debug] "+format, values...)
+	}
+}
+
+func debugPrintWARNING() {
+	debugPrintf(`[WARNING] Running in "debug" mode. Switch to "release" mode in production.
+ - using env:	export GEE_MODE=release
+ - using code:	gee.SetMode(gee.ReleaseMode)`)
+}
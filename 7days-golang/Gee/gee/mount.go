@@ -0,0 +1,71 @@
+package gee
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// WrapF wraps an http.HandlerFunc into a HandlerFunc
+func WrapF(f http.HandlerFunc) HandlerFunc {
+	return func(c *Context) {
+		f(c.Writer, c.Req)
+	}
+}
+
+// WrapH wraps an http.Handler into a HandlerFunc
+func WrapH(h http.Handler) HandlerFunc {
+	return func(c *Context) {
+		h.ServeHTTP(c.Writer, c.Req)
+	}
+}
+
+// Mount forwards requests of all methods under prefix to handler, with
+// prefix stripped from the URL path. The handler can be anything serving
+// HTTP, such as net/http/pprof, a geecache HTTPPool, a geerpc server or
+// another *Engine built separately, whose groups and middlewares then
+// apply after the ones of this group.
+func (group *RouterGroup) Mount(prefix string, handler http.Handler) {
+	absPrefix := path.Join("/", group.prefix, prefix)
+	h := stripPrefix(absPrefix, handler)
+
+	for _, method := range mountMethods {
+		group.addRoute(method, prefix, h)
+		group.addRoute(method, path.Join(prefix, "/*filepath"), h)
+	}
+}
+
+// mountMethods are the HTTP methods forwarded by Mount
+var mountMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodHead, http.MethodOptions,
+	http.MethodConnect, http.MethodTrace,
+}
+
+// stripPrefix is like http.StripPrefix, but always leaves a rooted path
+// so that a mounted Engine can match its routes
+func stripPrefix(prefix string, h http.Handler) HandlerFunc {
+	if prefix == "/" {
+		return WrapH(h)
+	}
+
+	return func(c *Context) {
+		p := strings.TrimPrefix(c.Req.URL.Path, prefix)
+		rp := strings.TrimPrefix(c.Req.URL.RawPath, prefix)
+		if p == "" || p[0] != '/' {
+			p = "/" + p
+		}
+		if rp != "" && rp[0] != '/' {
+			rp = "/" + rp
+		}
+
+		req := new(http.Request)
+		*req = *c.Req
+		req.URL = new(url.URL)
+		*req.URL = *c.Req.URL
+		req.URL.Path = p
+		req.URL.RawPath = rp
+		h.ServeHTTP(c.Writer, req)
+	}
+}
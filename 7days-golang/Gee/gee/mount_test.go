@@ -0,0 +1,44 @@
+package gee
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMount(t *testing.T) {
+	inner := New()
+	inner.GET("/hello/:name", func(c *Context) {
+		c.String(http.StatusOK, "inner hello %s", c.Param("name"))
+	})
+	echo := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.WriteString(w, req.Method+" "+req.URL.Path)
+	})
+
+	r := New()
+	api := r.Group("/api")
+	api.Mount("/inner", inner)
+	api.Mount("/echo", echo)
+	r.GET("/wrapped", WrapF(echo))
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+	}{
+		{"GET", "/api/inner/hello/alice", 200, "inner hello alice"},
+		{"GET", "/api/inner/missing", 404, ""},
+		{"PUT", "/api/echo/a/b", 200, "PUT /a/b"},
+		{"DELETE", "/api/echo", 200, "DELETE /"},
+		{"GET", "/api/echoes", 404, ""},
+		{"GET", "/wrapped", 200, "GET /wrapped"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code || tt.body != "" && w.Body.String() != tt.body {
+			t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.path, w.Code, w.Body, tt.code, tt.body)
+		}
+	}
+}
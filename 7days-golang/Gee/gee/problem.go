@@ -0,0 +1,128 @@
+package gee
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// ProblemContentType is the media type of RFC 9457 problem details
+const ProblemContentType = "application/problem+json"
+
+// Problem is an RFC 9457 problem details object. Extension members are
+// serialized next to the standard ones.
+type Problem struct {
+	Type       string // URI identifying the problem type, defaults to about:blank
+	Title      string // defaults to the status text
+	Status     int
+	Detail     string
+	Instance   string         // defaults to the request path
+	Extensions map[string]any // additional members, e.g. "errors"
+}
+
+// NewProblem creates a Problem of type about:blank
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Status: status,
+		Title:  http.StatusText(status),
+		Detail: detail,
+	}
+}
+
+// With sets an extension member and returns p for chaining
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]any)
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+// Error implements error so that handlers can return problems
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Title + ": " + p.Detail
+	}
+	return p.Title
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	typ := p.Type
+	if typ == "" {
+		typ = "about:blank"
+	}
+	m["type"] = typ
+	m["title"] = p.Title
+	m["status"] = p.Status
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+// Problem writes p as application/problem+json and aborts the chain. p
+// isn't modified, so it may be shared.
+func (c *Context) Problem(p *Problem) {
+	cp := *p
+	p = &cp
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = c.Path
+	}
+
+	c.Abort()
+	c.SetHeader("Content-Type", ProblemContentType)
+	c.Status(p.Status)
+	if err := json.NewEncoder(c.Writer).Encode(p); err != nil {
+		http.Error(c.Writer, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var exposeErrors atomic.Bool
+
+// ExposeErrors sets whether ProblemError puts the message of unexpected
+// errors, recovered panics included, in "detail". It's off by default
+// since messages may leak internals, turn it on for development only.
+func ExposeErrors(on bool) {
+	exposeErrors.Store(on)
+}
+
+// ProblemError converts err into a problem and writes it: *Problem is
+// written as is, binding errors become 400 and validation errors 422
+// with an "errors" member. Other errors become 500, their message is
+// only exposed with ExposeErrors.
+func (c *Context) ProblemError(err error) {
+	var (
+		problem *Problem
+		binding *BindingError
+		invalid ValidationErrors
+	)
+	switch {
+	case errors.As(err, &problem):
+		c.Problem(problem)
+	case errors.As(err, &invalid):
+		c.Problem(NewProblem(http.StatusUnprocessableEntity, "request validation failed").
+			With("errors", []FieldError(invalid)))
+	case errors.As(err, &binding):
+		c.Problem(NewProblem(http.StatusBadRequest, binding.Error()))
+	default:
+		p := NewProblem(http.StatusInternalServerError, "")
+		if exposeErrors.Load() {
+			p.Detail = err.Error()
+		}
+		c.Problem(p)
+	}
+}
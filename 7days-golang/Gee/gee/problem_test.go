@@ -0,0 +1,91 @@
+package gee
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveProblem runs req through engine and decodes the problem it answers with
+func serveProblem(t *testing.T, engine *Engine, method, path, body string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	if ct := w.Header().Get("Content-Type"); ct != ProblemContentType {
+		t.Fatalf("%s %s: Content-Type = %q, want %q", method, path, ct, ProblemContentType)
+	}
+	var p map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("%s %s: decoding %q: %v", method, path, w.Body, err)
+	}
+	return w, p
+}
+
+type signup struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func (s *signup) Validate() error {
+	if s.Name == "" {
+		return ValidationErrors{{Field: "name", Detail: "is required"}}
+	}
+	return nil
+}
+
+func TestProblem(t *testing.T) {
+	notFound := &Problem{Status: http.StatusNotFound}
+	r := New()
+	r.GET("/shared/*path", func(c *Context) {
+		c.Problem(notFound)
+	})
+	r.GET("/secret", func(c *Context) {
+		c.ProblemError(errors.New("db password is hunter2"))
+	})
+	r.POST("/signup", func(c *Context) {
+		var s signup
+		if c.BindJSON(&s) == nil {
+			c.String(http.StatusOK, "ok")
+		}
+	})
+
+	// a shared problem is never modified
+	for _, path := range []string{"/shared/a", "/shared/b"} {
+		_, p := serveProblem(t, r, "GET", path, "")
+		if p["instance"] != path || p["title"] != "Not Found" || p["status"] != 404.0 {
+			t.Fatalf("GET %s = %v", path, p)
+		}
+	}
+	if notFound.Instance != "" || notFound.Title != "" {
+		t.Fatalf("shared problem modified: %+v", notFound)
+	}
+
+	// unexpected errors keep their message unless exposed
+	if _, p := serveProblem(t, r, "GET", "/secret", ""); p["status"] != 500.0 || p["detail"] != nil {
+		t.Fatalf("GET /secret = %v, want a 500 without detail", p)
+	}
+	ExposeErrors(true)
+	_, p := serveProblem(t, r, "GET", "/secret", "")
+	ExposeErrors(false)
+	if p["detail"] != "db password is hunter2" {
+		t.Fatalf("GET /secret = %v with ExposeErrors, want the detail", p)
+	}
+
+	if w, p := serveProblem(t, r, "POST", "/signup", `{"age": "ten"}`); w.Code != 400 || !strings.Contains(p["detail"].(string), "age") {
+		t.Fatalf("POST /signup with a bad type = %d %v", w.Code, p)
+	}
+	w, p := serveProblem(t, r, "POST", "/signup", `{"age": 10}`)
+	if errs, _ := p["errors"].([]any); w.Code != 422 || len(errs) != 1 {
+		t.Fatalf("POST /signup without name = %d %v", w.Code, p)
+	}
+
+	if w, _ := serveProblem(t, r, "GET", "/missing", ""); w.Code != 404 {
+		t.Fatalf("GET /missing = %d, want 404", w.Code)
+	}
+	if w, _ := serveProblem(t, r, "DELETE", "/signup", ""); w.Code != 405 || w.Header().Get("Allow") != "POST" {
+		t.Fatalf("DELETE /signup = %d, Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+}
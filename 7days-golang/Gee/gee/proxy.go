@@ -0,0 +1,333 @@
+package gee
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Upstream is a proxy target with its passive health state
+type Upstream struct {
+	URL *url.URL
+
+	active       int64 // in-flight requests
+	fails        int64 // consecutive failures
+	ejectedUntil int64 // unix nano, 0 if healthy
+	proxy        *httputil.ReverseProxy
+}
+
+// Active returns the number of in-flight requests to the upstream
+func (u *Upstream) Active() int64 {
+	return atomic.LoadInt64(&u.active)
+}
+
+// Healthy reports whether the upstream is currently not ejected
+func (u *Upstream) Healthy() bool {
+	return time.Now().UnixNano() >= atomic.LoadInt64(&u.ejectedUntil)
+}
+
+func (u *Upstream) succeed() {
+	atomic.StoreInt64(&u.fails, 0)
+}
+
+func (u *Upstream) fail(maxFails int, ejectTimeout time.Duration) {
+	if atomic.AddInt64(&u.fails, 1) >= int64(maxFails) {
+		atomic.StoreInt64(&u.fails, 0)
+		atomic.StoreInt64(&u.ejectedUntil, time.Now().Add(ejectTimeout).UnixNano())
+		log.Printf("[Proxy] eject upstream %s for %v", u.URL, ejectTimeout)
+	}
+}
+
+// Balancer selects the upstream for a request among the candidates,
+// which is never empty
+type Balancer interface {
+	Pick(c *Context, candidates []*Upstream) *Upstream
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+// RoundRobin returns a Balancer cycling through the upstreams
+func RoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+func (b *roundRobin) Pick(_ *Context, candidates []*Upstream) *Upstream {
+	n := atomic.AddUint64(&b.next, 1) - 1
+	return candidates[n%uint64(len(candidates))]
+}
+
+type leastConnections struct{}
+
+// LeastConnections returns a Balancer picking the upstream with the
+// fewest in-flight requests
+func LeastConnections() Balancer {
+	return leastConnections{}
+}
+
+func (leastConnections) Pick(_ *Context, candidates []*Upstream) *Upstream {
+	best := candidates[0]
+	for _, u := range candidates[1:] {
+		if u.Active() < best.Active() {
+			best = u
+		}
+	}
+	return best
+}
+
+type consistentHash struct {
+	key func(*Context) string
+}
+
+// ConsistentHash returns a Balancer mapping requests with the same key to
+// the same upstream. It uses rendezvous hashing, so ejecting an upstream
+// only moves the keys it owned. key defaults to the client IP.
+func ConsistentHash(key func(*Context) string) Balancer {
+	if key == nil {
+		key = func(c *Context) string { return c.ClientIP() }
+	}
+	return &consistentHash{key: key}
+}
+
+func (b *consistentHash) Pick(c *Context, candidates []*Upstream) *Upstream {
+	key := b.key(c)
+
+	var best *Upstream
+	var bestScore uint32
+	for _, u := range candidates {
+		score := crc32.ChecksumIEEE([]byte(u.URL.String() + "#" + key))
+		if best == nil || score > bestScore {
+			best, bestScore = u, score
+		}
+	}
+	return best
+}
+
+// ProxyOptions configures Proxy
+type ProxyOptions struct {
+	Balancer Balancer // default RoundRobin
+	// Rewrite is the upstream path, where :name and *name segments are
+	// replaced by the route Params, e.g. "/api/*filepath". The request
+	// path is forwarded as it is if empty.
+	Rewrite string
+
+	SetRequestHeader     map[string]string
+	RemoveRequestHeader  []string
+	SetResponseHeader    map[string]string
+	RemoveResponseHeader []string
+
+	Retries      int           // extra attempts for idempotent requests
+	MaxFails     int           // consecutive failures before ejection, default 3
+	EjectTimeout time.Duration // how long an upstream stays ejected, default 30s
+	Transport    http.RoundTripper
+}
+
+// proxyAttempt carries the outcome of one round trip through the request
+// context, since httputil.ReverseProxy reports errors by callback
+type proxyAttempt struct {
+	err   error
+	retry bool // a failed response may still be retried on another upstream
+}
+
+type proxyAttemptKey struct{}
+
+var errRetryableStatus = errors.New("retryable upstream status")
+
+// Proxy returns a handler forwarding requests to the targets, it panics
+// if a target is not a valid URL
+func Proxy(targets []string, opts ProxyOptions) HandlerFunc {
+	if len(targets) == 0 {
+		panic("gee: Proxy needs at least one target")
+	}
+	if opts.Balancer == nil {
+		opts.Balancer = RoundRobin()
+	}
+	if opts.MaxFails <= 0 {
+		opts.MaxFails = 3
+	}
+	if opts.EjectTimeout <= 0 {
+		opts.EjectTimeout = 30 * time.Second
+	}
+
+	upstreams := make([]*Upstream, 0, len(targets))
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			panic("gee: invalid proxy target: " + err.Error())
+		}
+		upstream := &Upstream{URL: u}
+		upstream.proxy = newReverseProxy(upstream, &opts)
+		upstreams = append(upstreams, upstream)
+	}
+
+	return func(c *Context) {
+		var body []byte
+		attempts := 1
+		if isIdempotent(c.Method) && opts.Retries > 0 {
+			attempts += opts.Retries
+			if c.Req.Body != nil && c.Req.Body != http.NoBody {
+				var err error
+				if body, err = io.ReadAll(c.Req.Body); err != nil {
+					c.Fail(http.StatusBadRequest, "failed to read request body")
+					return
+				}
+			}
+		}
+
+		path := c.Req.URL.Path
+		if opts.Rewrite != "" {
+			path = rewritePath(opts.Rewrite, c.Params)
+		}
+
+		tried := make(map[*Upstream]bool, attempts)
+		var lastErr error
+		for i := 0; i < attempts; i++ {
+			upstream := opts.Balancer.Pick(c, candidates(upstreams, tried))
+			tried[upstream] = true
+
+			attempt := &proxyAttempt{retry: i < attempts-1}
+			req := c.Req.Clone(context.WithValue(c.Req.Context(), proxyAttemptKey{}, attempt))
+			req.URL.Path, req.URL.RawPath = path, ""
+			if body != nil {
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				req.ContentLength = int64(len(body))
+			}
+
+			atomic.AddInt64(&upstream.active, 1)
+			upstream.proxy.ServeHTTP(c.Writer, req)
+			atomic.AddInt64(&upstream.active, -1)
+
+			if attempt.err == nil {
+				return
+			}
+			lastErr = attempt.err
+			if errors.Is(lastErr, context.Canceled) {
+				break // the client went away
+			}
+			log.Printf("[Proxy] %s %s via %s: %v", c.Method, path, upstream.URL, lastErr)
+		}
+		c.Fail(http.StatusBadGateway, http.StatusText(http.StatusBadGateway))
+	}
+}
+
+func newReverseProxy(upstream *Upstream, opts *ProxyOptions) *httputil.ReverseProxy {
+	target := upstream.URL
+	return &httputil.ReverseProxy{
+		Transport: opts.Transport,
+		Director: func(req *http.Request) {
+			if _, ok := req.Header["X-Forwarded-Host"]; !ok {
+				req.Header.Set("X-Forwarded-Host", req.Host)
+			}
+			if req.TLS != nil {
+				req.Header.Set("X-Forwarded-Proto", "https")
+			} else {
+				req.Header.Set("X-Forwarded-Proto", "http")
+			}
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = singleJoiningSlash(target.Path, req.URL.Path)
+			req.Host = target.Host
+			for _, name := range opts.RemoveRequestHeader {
+				req.Header.Del(name)
+			}
+			for name, value := range opts.SetRequestHeader {
+				req.Header.Set(name, value)
+			}
+		},
+		ModifyResponse: func(res *http.Response) error {
+			attempt := res.Request.Context().Value(proxyAttemptKey{}).(*proxyAttempt)
+			if res.StatusCode >= http.StatusInternalServerError {
+				upstream.fail(opts.MaxFails, opts.EjectTimeout)
+				if attempt.retry && retryableStatus(res.StatusCode) {
+					return errRetryableStatus
+				}
+			} else {
+				upstream.succeed()
+			}
+			for _, name := range opts.RemoveResponseHeader {
+				res.Header.Del(name)
+			}
+			for name, value := range opts.SetResponseHeader {
+				res.Header.Set(name, value)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			attempt := req.Context().Value(proxyAttemptKey{}).(*proxyAttempt)
+			if !errors.Is(err, errRetryableStatus) && !errors.Is(err, context.Canceled) {
+				upstream.fail(opts.MaxFails, opts.EjectTimeout)
+			}
+			attempt.err = err
+		},
+	}
+}
+
+// candidates returns the healthy upstreams not tried yet, falling back to
+// all untried ones, then to all of them, so that a request is never refused
+// by the balancer itself
+func candidates(upstreams []*Upstream, tried map[*Upstream]bool) []*Upstream {
+	var healthy, untried []*Upstream
+	for _, u := range upstreams {
+		if tried[u] {
+			continue
+		}
+		untried = append(untried, u)
+		if u.Healthy() {
+			healthy = append(healthy, u)
+		}
+	}
+	switch {
+	case len(healthy) > 0:
+		return healthy
+	case len(untried) > 0:
+		return untried
+	}
+	return upstreams
+}
+
+// rewritePath fills the :name and *name segments of pattern with params
+func rewritePath(pattern string, params map[string]string) string {
+	parts := strings.Split(pattern, "/")
+	for i, part := range parts {
+		if part != "" && (part[0] == ':' || part[0] == '*') {
+			parts[i] = params[part[1:]]
+		}
+	}
+	return "/" + strings.TrimLeft(strings.Join(parts, "/"), "/")
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable ||
+		code == http.StatusGatewayTimeout
+}
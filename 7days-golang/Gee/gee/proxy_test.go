@@ -0,0 +1,104 @@
+package gee
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	engine := New()
+	if err := engine.SetTrustedProxies("10.0.0.0/8", "::1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.SetTrustedProxies("10.0.0.0/8", "proxy"); err == nil {
+		t.Fatal("SetTrustedProxies accepted an invalid proxy")
+	}
+
+	tests := []struct {
+		remote, xff, realIP, want string
+	}{
+		{"1.2.3.4:5678", "", "", "1.2.3.4"},
+		{"1.2.3.4:5678", "6.6.6.6", "6.6.6.6", "1.2.3.4"},
+		{"10.0.0.1:5678", "1.2.3.4", "", "1.2.3.4"},
+		{"10.0.0.1:5678", "6.6.6.6, 1.2.3.4, 10.0.0.2", "", "1.2.3.4"},
+		{"10.0.0.1:5678", "10.0.0.3, 10.0.0.2", "", "10.0.0.3"},
+		{"10.0.0.1:5678", "", "1.2.3.4", "1.2.3.4"},
+		{"[::1]:5678", "garbage, 1.2.3.4", "", "1.2.3.4"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			req.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			req.Header.Set("X-Real-Ip", tt.realIP)
+		}
+		c := newContext(httptest.NewRecorder(), req)
+		c.engine = engine
+		if got := c.ClientIP(); got != tt.want {
+			t.Errorf("ClientIP() from %s with X-Forwarded-For %q = %s, want %s", tt.remote, tt.xff, got, tt.want)
+		}
+	}
+}
+
+func newUpstream(t *testing.T, name string, status int) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+		io.WriteString(w, name+" "+req.URL.Path)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestProxy(t *testing.T) {
+	a := newUpstream(t, "a", http.StatusOK)
+	b := newUpstream(t, "b", http.StatusOK)
+	down := newUpstream(t, "down", http.StatusServiceUnavailable)
+
+	r := New()
+	r.GET("/rr/*path", Proxy([]string{a.URL, b.URL}, ProxyOptions{Rewrite: "/api/*path"}))
+	r.Handle("DELETE", "/rr/*path", Proxy([]string{b.URL}, ProxyOptions{}))
+	r.GET("/retry/*path", Proxy([]string{down.URL, a.URL}, ProxyOptions{Retries: 1, MaxFails: 1}))
+	r.GET("/hash/*path", Proxy([]string{a.URL, b.URL}, ProxyOptions{
+		Balancer: ConsistentHash(func(c *Context) string { return c.Query("user") }),
+	}))
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %q", path, w.Code, w.Body)
+		}
+		return w.Body.String()
+	}
+
+	if got := []string{get("/rr/x"), get("/rr/y"), get("/rr/z")}; got[0] != "a /api/x" || got[1] != "b /api/y" || got[2] != "a /api/z" {
+		t.Errorf("round robin = %q", got)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("DELETE", "/rr/x", nil))
+	if w.Body.String() != "b /rr/x" {
+		t.Errorf("DELETE /rr/x = %d %q", w.Code, w.Body)
+	}
+	for i := 0; i < 3; i++ {
+		if got := get("/retry/x"); got != "a /retry/x" {
+			t.Errorf("GET /retry/x = %q, want it retried on a", got)
+		}
+	}
+	for _, user := range []string{"alice", "bob", "carol"} {
+		if first := get("/hash/x?user=" + user); get("/hash/x?user="+user) != first {
+			t.Errorf("user %s moved between upstreams", user)
+		}
+	}
+}
+
+func TestLeastConnections(t *testing.T) {
+	busy := &Upstream{URL: &url.URL{Host: "busy"}, active: 3}
+	idle := &Upstream{URL: &url.URL{Host: "idle"}, active: 1}
+	if u := LeastConnections().Pick(nil, []*Upstream{busy, idle}); u != idle {
+		t.Fatalf("LeastConnections picked %s", u.URL.Host)
+	}
+}
@@ -1,37 +1,192 @@
 package gee
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"runtime"
+	"runtime/debug"
 	"strings"
+	"syscall"
 )
 
+// PanicReport describes a panic recovered while serving a request
+type PanicReport struct {
+	Value  any
+	Method string
+	Path   string
+	// Stack is the full stack of the panicking goroutine, or of all
+	// goroutines with RecoveryConfig.AllGoroutines
+	Stack []byte
+	// Source holds the code around each frame, only in debug mode
+	Source string
+	// BrokenPipe is set when the panic comes from writing to a client
+	// that went away, no response is sent then
+	BrokenPipe bool
+}
+
+// PanicReporter is notified of every recovered panic
+type PanicReporter interface {
+	ReportPanic(c *Context, report *PanicReport)
+}
+
+// PanicReporterFunc implements PanicReporter with a function
+type PanicReporterFunc func(c *Context, report *PanicReport)
+
+func (f PanicReporterFunc) ReportPanic(c *Context, report *PanicReport) {
+	f(c, report)
+}
+
+// Recovery recovers from panics, logs them and responds with a 500
+// problem
 func Recovery() HandlerFunc {
+	return CustomRecovery(nil)
+}
+
+// CustomRecovery is like Recovery, but hands the panics to reporter,
+// which defaults to the std logger
+func CustomRecovery(reporter PanicReporter) HandlerFunc {
+	return RecoveryWithConfig(RecoveryConfig{Reporter: reporter})
+}
+
+// RecoveryConfig configures RecoveryWithConfig
+type RecoveryConfig struct {
+	// Reporter is handed every panic, it defaults to the std logger
+	Reporter PanicReporter
+	// AllGoroutines reports the stacks of all goroutines instead of the
+	// panicking one, which helps with deadlocks and leaks but stops the
+	// world while collecting them
+	AllGoroutines bool
+}
+
+// RecoveryWithConfig recovers from panics and responds with a 500
+// problem. Nothing is written if the response was already committed or
+// the client connection is broken.
+func RecoveryWithConfig(config RecoveryConfig) HandlerFunc {
+	reporter := config.Reporter
+	if reporter == nil {
+		reporter = PanicReporterFunc(logPanic)
+	}
 	return func(c *Context) {
 		defer func() {
-			if err := recover(); err != nil {
-				msg := fmt.Sprintf("%s", err)
-				log.Printf("%s\n\n", trace(msg))
-				c.Fail(http.StatusInternalServerError, "Internal Server Error")
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				// net/http aborts the response silently
+				panic(err)
+			}
+
+			report := &PanicReport{
+				Value:      err,
+				Method:     c.Method,
+				Path:       c.Path,
+				Stack:      stack(config.AllGoroutines),
+				BrokenPipe: isBrokenPipe(err),
+			}
+			if IsDebugging() {
+				report.Source = sourceSnippets(3)
 			}
+			reporter.ReportPanic(c, report)
+
+			if report.BrokenPipe || c.Written() {
+				c.Abort()
+				return
+			}
+			perr, ok := err.(error)
+			if !ok {
+				perr = fmt.Errorf("%v", err)
+			}
+			c.ProblemError(perr)
 		}()
 
 		c.Next()
 	}
 }
 
-func trace(msg string) string {
-	var pcs [32]uintptr
-	n := runtime.Callers(3, pcs[:])
+func logPanic(c *Context, report *PanicReport) {
+	if report.BrokenPipe {
+		log.Printf("[Recovery] %s %s: %v (broken pipe)", report.Method, report.Path, report.Value)
+		return
+	}
+	log.Printf("[Recovery] %s %s: %v\n%s%s", report.Method, report.Path, report.Value, report.Stack, report.Source)
+}
+
+// stack returns the stack of the calling goroutine, or of all goroutines
+func stack(all bool) []byte {
+	if !all {
+		return debug.Stack()
+	}
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// isBrokenPipe reports whether the panic comes from a closed client
+// connection
+func isBrokenPipe(v any) bool {
+	err, ok := v.(error)
+	if !ok {
+		return false
+	}
+	if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+}
 
+// sourceSnippets returns the source lines around each non-runtime frame
+// of the calling goroutine
+func sourceSnippets(skip int) string {
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(skip, pcs)
+		if n < len(pcs) {
+			pcs = pcs[:n]
+			break
+		}
+		pcs = make([]uintptr, 2*len(pcs))
+	}
+
+	const around = 2 // lines before and after
+	files := make(map[string][]string)
 	var sb strings.Builder
-	sb.WriteString(msg + "\nTraceback:")
-	for _, pc := range pcs[:n] {
-		fn := runtime.FuncForPC(pc)
-		file, line := fn.FileLine(pc)
-		sb.WriteString(fmt.Sprintf("\n\t%s:%d", file, line))
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "runtime.") {
+			lines, ok := files[frame.File]
+			if !ok {
+				if data, err := os.ReadFile(frame.File); err == nil {
+					lines = strings.Split(string(data), "\n")
+				}
+				files[frame.File] = lines
+			}
+
+			fmt.Fprintf(&sb, "\n%s:%d (%s)\n", frame.File, frame.Line, frame.Function)
+			for i := frame.Line - around; i <= frame.Line+around; i++ {
+				if i < 1 || i > len(lines) {
+					continue
+				}
+				marker := " "
+				if i == frame.Line {
+					marker = ">"
+				}
+				fmt.Fprintf(&sb, "\t%s%4d: %s\n", marker, i, strings.TrimRight(lines[i-1], "\r"))
+			}
+		}
+		if !more {
+			break
+		}
 	}
 	return sb.String()
 }
@@ -0,0 +1,87 @@
+package gee
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func newRecoveryEngine(config RecoveryConfig) *Engine {
+	r := New()
+	r.Use(RecoveryWithConfig(config))
+	r.GET("/panic", func(c *Context) {
+		panic("boom")
+	})
+	r.GET("/partial", func(c *Context) {
+		c.String(http.StatusOK, "partial")
+		panic("boom")
+	})
+	r.GET("/pipe", func(c *Context) {
+		panic(fmt.Errorf("write tcp: %w", syscall.EPIPE))
+	})
+	r.GET("/abort", func(c *Context) {
+		panic(http.ErrAbortHandler)
+	})
+	return r
+}
+
+func TestRecovery(t *testing.T) {
+	var reports []*PanicReport
+	r := newRecoveryEngine(RecoveryConfig{
+		Reporter: PanicReporterFunc(func(c *Context, report *PanicReport) {
+			reports = append(reports, report)
+		}),
+	})
+	serve := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	w := serve("/panic")
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Type") != ProblemContentType {
+		t.Fatalf("GET /panic = %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if len(reports) != 1 || reports[0].Value != "boom" || reports[0].Path != "/panic" || len(reports[0].Stack) == 0 {
+		t.Fatalf("reports = %+v", reports)
+	}
+
+	// the committed response is left alone
+	if w := serve("/partial"); w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Fatalf("GET /partial = %d %q, want the partial response only", w.Code, w.Body)
+	}
+
+	if w := serve("/pipe"); w.Body.Len() != 0 || !reports[2].BrokenPipe {
+		t.Fatalf("GET /pipe wrote %q, broken pipe %v", w.Body, reports[2].BrokenPipe)
+	}
+
+	func() {
+		defer func() {
+			if err := recover(); err != http.ErrAbortHandler {
+				t.Fatalf("GET /abort panicked with %v, want http.ErrAbortHandler", err)
+			}
+		}()
+		serve("/abort")
+	}()
+	if len(reports) != 3 {
+		t.Fatalf("http.ErrAbortHandler was reported: %+v", reports[3])
+	}
+}
+
+func TestRecoveryAllGoroutines(t *testing.T) {
+	var stack string
+	r := newRecoveryEngine(RecoveryConfig{
+		Reporter: PanicReporterFunc(func(c *Context, report *PanicReport) {
+			stack = string(report.Stack)
+		}),
+		AllGoroutines: true,
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+	// the test runner's goroutine waits on this one
+	if n := strings.Count(stack, "goroutine "); n < 2 {
+		t.Fatalf("stack has %d goroutines, want all of them:\n%s", n, stack)
+	}
+}
@@ -0,0 +1,68 @@
+package gee
+
+// RouteTable is a copy of the route table being updated by UpdateRoutes
+type RouteTable struct {
+	router *router
+}
+
+// UpdateRoutes applies fn to a copy of the route table, then publishes the
+// copy atomically. Requests being served keep the table they started with,
+// so routes can be added or removed at runtime, e.g. by feature flags or
+// plugin modules, without dropping requests. Updates are serialized.
+func (engine *Engine) UpdateRoutes(fn func(t *RouteTable)) {
+	engine.routerMu.Lock()
+	defer engine.routerMu.Unlock()
+
+	next := engine.router.Load().clone()
+	fn(&RouteTable{router: next})
+	engine.router.Store(next)
+}
+
+// addRoute registers a route. Until the engine serves its first request
+// the table is modified in place, copying it for each route would make
+// registering n routes O(n²).
+func (engine *Engine) addRoute(method string, pattern string, handler HandlerFunc) {
+	engine.routerMu.Lock()
+	if !engine.serving.Load() {
+		engine.router.Load().addRoute(method, pattern, handler)
+		engine.routerMu.Unlock()
+		return
+	}
+	engine.routerMu.Unlock()
+
+	engine.UpdateRoutes(func(t *RouteTable) {
+		t.router.addRoute(method, pattern, handler)
+	})
+}
+
+// Handle registers a route, pattern is absolute, i.e. not relative to
+// any RouterGroup. The group middlewares still apply by prefix.
+func (t *RouteTable) Handle(method string, pattern string, handler HandlerFunc) {
+	debugPrintf("Route %4s - %s", method, pattern)
+	t.router.addRoute(method, pattern, handler)
+}
+
+// Remove unregisters a route and reports whether it existed
+func (t *RouteTable) Remove(method string, pattern string) bool {
+	debugPrintf("Remove route %4s - %s", method, pattern)
+	return t.router.removeRoute(method, pattern)
+}
+
+// Reset removes all routes, to rebuild the table from scratch
+func (t *RouteTable) Reset() {
+	*t.router = *newRouter()
+}
+
+// Has reports whether a route is registered
+func (t *RouteTable) Has(method string, pattern string) bool {
+	_, ok := t.router.handlers[method+"-"+pattern]
+	return ok
+}
+
+// RemoveRoute unregisters a route at runtime and reports whether it existed
+func (engine *Engine) RemoveRoute(method string, pattern string) (removed bool) {
+	engine.UpdateRoutes(func(t *RouteTable) {
+		removed = t.Remove(method, pattern)
+	})
+	return
+}
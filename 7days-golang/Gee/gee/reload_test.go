@@ -0,0 +1,120 @@
+package gee
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestRemoveRoute(t *testing.T) {
+	r := newTestRouter()
+	if !r.removeRoute("GET", "/hello/:name") {
+		t.Fatal("failed to remove /hello/:name")
+	}
+	if r.removeRoute("GET", "/hello/:name") {
+		t.Fatal("removed /hello/:name twice")
+	}
+
+	if n, _ := r.getRoute("GET", "/hello/alice"); n != nil {
+		t.Fatalf("/hello/alice matched %q after removal", n.pattern)
+	}
+	// siblings and descendants sharing the trie path must survive
+	for path, want := range map[string]string{
+		"/hello/alice/getAge": "/hello/:name/getAge",
+		"/hello/b/c":          "/hello/b/c",
+		"/hi/bob":             "/hi/:name",
+	} {
+		if n, _ := r.getRoute("GET", path); n == nil || n.pattern != want {
+			t.Errorf("getRoute(%q) = %v, want: %s", path, n, want)
+		}
+	}
+}
+
+func TestUpdateRoutesConcurrently(t *testing.T) {
+	engine := New()
+	engine.GET("/stable", func(c *Context) {
+		c.String(http.StatusOK, "stable")
+	})
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				engine.ServeHTTP(w, httptest.NewRequest("GET", "/stable", nil))
+				if w.Code != http.StatusOK {
+					t.Errorf("/stable returned %d during updates", w.Code)
+					return
+				}
+				engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/flag/1", nil))
+			}
+		}()
+	}
+
+	for i := 0; i < 50; i++ {
+		pattern := fmt.Sprintf("/flag/%d", i%3)
+		engine.UpdateRoutes(func(rt *RouteTable) {
+			if rt.Has("GET", pattern) {
+				rt.Remove("GET", pattern)
+				return
+			}
+			rt.Handle("GET", pattern, func(c *Context) {
+				c.String(http.StatusOK, pattern)
+			})
+		})
+		engine.Group(pattern).Use(func(c *Context) { c.Next() })
+	}
+	close(stop)
+	wg.Wait()
+
+	engine.UpdateRoutes(func(rt *RouteTable) {
+		rt.Reset()
+		rt.Handle("GET", "/rebuilt", func(c *Context) {
+			c.String(http.StatusOK, "rebuilt")
+		})
+	})
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/stable", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("/stable returned %d after reset, want: 404", w.Code)
+	}
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/rebuilt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "rebuilt" {
+		t.Errorf("/rebuilt returned %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestAddRouteBeforeServing(t *testing.T) {
+	engine := New()
+	table := engine.router.Load()
+	for i := 0; i < 100; i++ {
+		engine.GET(fmt.Sprintf("/route/%d", i), func(c *Context) {})
+	}
+	if engine.router.Load() != table {
+		t.Fatal("routes registered before serving copied the table")
+	}
+
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/route/0", nil))
+	engine.GET("/late", func(c *Context) {
+		c.String(http.StatusOK, "late")
+	})
+	if engine.router.Load() == table || len(table.handlers) != 100 {
+		t.Fatal("a route registered while serving modified the published table")
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/late", nil))
+	if w.Body.String() != "late" {
+		t.Fatalf("/late returned %d %q", w.Code, w.Body)
+	}
+}
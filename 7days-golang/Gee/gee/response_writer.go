@@ -0,0 +1,85 @@
+package gee
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// responseWriter wraps http.ResponseWriter to record the status code and
+// the number of bytes written, so that middlewares can inspect the response
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+var (
+	_ http.ResponseWriter = (*responseWriter)(nil)
+	_ http.Flusher        = (*responseWriter)(nil)
+	_ http.Hijacker       = (*responseWriter)(nil)
+)
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	return &responseWriter{ResponseWriter: w}
+}
+
+// WriteHeader records the status code and sends the header
+func (w *responseWriter) WriteHeader(code int) {
+	if w.Written() {
+		return
+	}
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write sends an implicit 200 OK header if no header was written yet
+func (w *responseWriter) Write(data []byte) (int, error) {
+	if !w.Written() {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+// Status returns the response status code, 200 if nothing was written
+func (w *responseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Size returns the number of body bytes written
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+// Written reports whether the response header has been sent
+func (w *responseWriter) Written() bool {
+	return w.status != 0
+}
+
+// Flush implements http.Flusher
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.Written() {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+// Unwrap returns the underlying http.ResponseWriter, used by http.ResponseController
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
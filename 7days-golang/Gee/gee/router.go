@@ -1,7 +1,9 @@
 package gee
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 )
 
@@ -46,16 +48,49 @@ func (r *router) addRoute(method string, pattern string, handler HandlerFunc) {
 	r.handlers[key] = handler
 }
 
+// clone returns a deep copy of the router, which can be modified while
+// the original one keeps serving
+func (r *router) clone() *router {
+	c := newRouter()
+	for method, root := range r.trieRoots {
+		c.trieRoots[method] = root.clone()
+	}
+	for key, handler := range r.handlers {
+		c.handlers[key] = handler
+	}
+	return c
+}
+
+func (r *router) removeRoute(method string, pattern string) bool {
+	key := method + "-" + pattern
+	if _, ok := r.handlers[key]; !ok {
+		return false
+	}
+	delete(r.handlers, key)
+
+	if root, ok := r.trieRoots[method]; ok {
+		root.remove(pattern, parsePattern(pattern), 0)
+	}
+	return true
+}
+
 func (r *router) handle(c *Context) {
 	n, params := r.getRoute(c.Method, c.Path)
 	var handler HandlerFunc
 	if n != nil {
 		c.Params = params
+		c.fullPath = n.pattern
 		key := c.Method + "-" + n.pattern
 		handler = r.handlers[key]
+	} else if allowed := r.allowedMethods(c.Path); len(allowed) > 0 {
+		handler = func(c *Context) {
+			c.SetHeader("Allow", strings.Join(allowed, ", "))
+			c.Problem(NewProblem(http.StatusMethodNotAllowed,
+				fmt.Sprintf("method %s is not allowed for %s", c.Method, c.Path)))
+		}
 	} else {
 		handler = func(c *Context) {
-			c.String(http.StatusNotFound, "404 NOT FOUND: %s\n", c.Path)
+			c.Problem(NewProblem(http.StatusNotFound, "no route for "+c.Path))
 		}
 	}
 
@@ -90,3 +125,15 @@ func (r *router) getRoute(method string, path string) (*trieNode, map[string]str
 
 	return nil, nil
 }
+
+// allowedMethods returns the sorted methods having a route matching path
+func (r *router) allowedMethods(path string) []string {
+	var methods []string
+	for method := range r.trieRoots {
+		if n, _ := r.getRoute(method, path); n != nil {
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
@@ -1,7 +1,6 @@
 package gee
 
 import (
-	"log"
 	"net/http"
 	"path"
 )
@@ -11,10 +10,13 @@ type RouterGroup struct {
 	middlewares []HandlerFunc // 中间件
 	parent      *RouterGroup  // 父母分组
 	engine      *Engine       // 所有分组持有同一个 Engine 实例
+	versions    *versionSet   // API 版本
 }
 
 // Use add middleware to RouterGroup
 func (group *RouterGroup) Use(middlewares ...HandlerFunc) {
+	group.engine.mu.Lock()
+	defer group.engine.mu.Unlock()
 	group.middlewares = append(group.middlewares, middlewares...)
 }
 
@@ -27,14 +29,16 @@ func (group *RouterGroup) Group(prefix string) *RouterGroup {
 		engine: engine, // All group share one Engine instance
 	}
 	// Add to group lists
+	engine.mu.Lock()
 	engine.groups = append(engine.groups, newGroup)
+	engine.mu.Unlock()
 	return newGroup
 }
 
 func (group *RouterGroup) addRoute(method string, path string, handler HandlerFunc) {
 	pattern := group.prefix + path
-	log.Printf("Route %4s - %s", method, pattern)
-	group.engine.router.addRoute(method, pattern, handler)
+	debugPrintf("Route %4s - %s", method, pattern)
+	group.engine.addRoute(method, pattern, handler)
 }
 
 func (group *RouterGroup) GET(pattern string, handler HandlerFunc) {
@@ -45,6 +49,12 @@ func (group *RouterGroup) POST(pattern string, handler HandlerFunc) {
 	group.addRoute("POST", pattern, handler)
 }
 
+// Handle registers a handler for the given HTTP method, e.g. to proxy
+// methods other than GET and POST
+func (group *RouterGroup) Handle(method string, pattern string, handler HandlerFunc) {
+	group.addRoute(method, pattern, handler)
+}
+
 func (group *RouterGroup) createStaticHandler(relPath string, fs http.FileSystem) HandlerFunc {
 	absPath := path.Join(group.prefix, relPath)
 	fileServer := http.StripPrefix(absPath, http.FileServer(fs))
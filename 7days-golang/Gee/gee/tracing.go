@@ -0,0 +1,355 @@
+package gee
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// W3C Trace Context headers, see https://www.w3.org/TR/trace-context/
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+
+	maxTracestateMembers = 32
+	flagSampled          = 0x01
+)
+
+// TraceID identifies a whole trace
+type TraceID [16]byte
+
+// SpanID identifies a single span within a trace
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) MarshalJSON() ([]byte, error) { return json.Marshal(t.String()) }
+func (s SpanID) MarshalJSON() ([]byte, error)  { return json.Marshal(s.String()) }
+
+// SpanContext is the part of a span propagated across process boundaries
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+}
+
+// Sampled reports whether the sampled flag is set
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+// Traceparent formats the span context as a version 00 traceparent header
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+var errInvalidTraceparent = errors.New("invalid traceparent")
+
+// ParseTraceparent parses a traceparent header value
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+
+	value = strings.TrimSpace(value)
+	// version-traceid-parentid-flags: 2+1+32+1+16+1+2 = 55
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return sc, errInvalidTraceparent
+	}
+	version := value[:2]
+	switch {
+	case !isLowerHex(version) || version == "ff":
+		return sc, errInvalidTraceparent
+	case version == "00" && len(value) != 55:
+		return sc, errInvalidTraceparent
+	case len(value) > 55 && value[55] != '-': // future versions may append fields
+		return sc, errInvalidTraceparent
+	}
+
+	traceID, spanID, flags := value[3:35], value[36:52], value[53:55]
+	if !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return sc, errInvalidTraceparent
+	}
+	hex.Decode(sc.TraceID[:], []byte(traceID))
+	hex.Decode(sc.SpanID[:], []byte(spanID))
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags))
+	sc.Flags = f[0]
+
+	if sc.TraceID == (TraceID{}) || sc.SpanID == (SpanID{}) {
+		return SpanContext{}, errInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// parseTracestate normalizes a tracestate header, an invalid one is discarded
+func parseTracestate(value string) string {
+	var members []string
+	for _, m := range strings.Split(value, ",") {
+		m = strings.TrimSpace(m)
+		if m == "" {
+			continue
+		}
+		if i := strings.IndexByte(m, '='); i <= 0 || i == len(m)-1 {
+			return ""
+		}
+		members = append(members, m)
+	}
+	if len(members) > maxTracestateMembers {
+		return ""
+	}
+	return strings.Join(members, ",")
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// Span records a timed operation of a trace
+type Span struct {
+	Name       string         `json:"name"`
+	TraceID    TraceID        `json:"trace_id"`
+	SpanID     SpanID         `json:"span_id"`
+	ParentID   *SpanID        `json:"parent_id,omitempty"`
+	TraceState string         `json:"trace_state,omitempty"`
+	Sampled    bool           `json:"sampled"`
+	Start      time.Time      `json:"start"`
+	End        time.Time      `json:"end"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+
+	mu       sync.Mutex
+	exporter Exporter
+	ended    bool
+}
+
+// SpanContext returns the span context used to propagate this span
+func (s *Span) SpanContext() SpanContext {
+	sc := SpanContext{TraceID: s.TraceID, SpanID: s.SpanID, TraceState: s.TraceState}
+	if s.Sampled {
+		sc.Flags |= flagSampled
+	}
+	return sc
+}
+
+// SetAttribute annotates the span with a key/value pair
+func (s *Span) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]any)
+	}
+	s.Attributes[key] = value
+}
+
+// Finish ends the span and hands it to the exporter if it is sampled
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	if s.Sampled && s.exporter != nil {
+		if err := s.exporter.ExportSpan(s); err != nil {
+			log.Printf("[Tracing] export span %s: %v", s.SpanID, err)
+		}
+	}
+}
+
+// Duration returns how long the span lasted
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// StartSpan starts a child span of the span carried by ctx, or a new
+// root span if there's none. Call Finish on the returned span when done.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	span := &Span{Name: name, Start: time.Now(), SpanID: newSpanID()}
+	if parent != nil {
+		parentID := parent.SpanID
+		span.TraceID = parent.TraceID
+		span.ParentID = &parentID
+		span.TraceState = parent.TraceState
+		span.Sampled = parent.Sampled
+		span.exporter = parent.exporter
+	} else {
+		span.TraceID = newTraceID()
+		span.Sampled = true
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// InjectTraceparent sets the trace context headers of an outgoing request
+// so that the downstream service continues the trace carried by ctx
+func InjectTraceparent(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	sc := span.SpanContext()
+	header.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set(TracestateHeader, sc.TraceState)
+	}
+}
+
+func newTraceID() (id TraceID) {
+	for id == (TraceID{}) {
+		rand.Read(id[:])
+	}
+	return
+}
+
+func newSpanID() (id SpanID) {
+	for id == (SpanID{}) {
+		rand.Read(id[:])
+	}
+	return
+}
+
+// Exporter receives finished spans
+type Exporter interface {
+	ExportSpan(span *Span) error
+}
+
+// Tracing creates a server span around the rest of the handler chain,
+// continuing the trace from the incoming traceparent header if present.
+// The span is available through Context.Span and the request context.
+func Tracing(exporter Exporter) HandlerFunc {
+	return func(c *Context) {
+		span := &Span{
+			Name:     c.Method + " " + c.FullPath(),
+			SpanID:   newSpanID(),
+			Start:    time.Now(),
+			exporter: exporter,
+		}
+		if sc, err := ParseTraceparent(c.Req.Header.Get(TraceparentHeader)); err == nil {
+			parentID := sc.SpanID
+			span.TraceID = sc.TraceID
+			span.ParentID = &parentID
+			span.Sampled = sc.Sampled()
+			span.TraceState = parseTracestate(c.Req.Header.Get(TracestateHeader))
+		} else {
+			span.TraceID = newTraceID()
+			span.Sampled = true
+		}
+
+		span.SetAttribute("http.method", c.Method)
+		span.SetAttribute("http.route", c.FullPath())
+		span.SetAttribute("http.target", c.Req.URL.RequestURI())
+		c.Set(spanKey, span)
+		c.Req = c.Req.WithContext(ContextWithSpan(c.Req.Context(), span))
+
+		defer func() {
+			span.SetAttribute("http.status_code", c.writer.Status())
+			span.Finish()
+		}()
+		c.Next()
+	}
+}
+
+const spanKey = "gee.span"
+
+// Span return the server span created by the Tracing middleware, or nil
+func (c *Context) Span() *Span {
+	span, _ := c.Keys[spanKey].(*Span)
+	return span
+}
+
+// InMemoryExporter keeps finished spans in memory, mainly for tests
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+var _ Exporter = (*InMemoryExporter)(nil)
+
+// ExportSpan implements Exporter
+func (e *InMemoryExporter) ExportSpan(span *Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+// Spans returns the exported spans in the order they finished
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*Span(nil), e.spans...)
+}
+
+// Reset drops all exported spans
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// JSONLinesExporter writes each finished span as one JSON object per line
+type JSONLinesExporter struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+var _ Exporter = (*JSONLinesExporter)(nil)
+
+// NewJSONLinesExporter opens the file at path for appending
+func NewJSONLinesExporter(path string) (*JSONLinesExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesExporter{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// ExportSpan implements Exporter
+func (e *JSONLinesExporter) ExportSpan(span *Span) error {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(span)
+}
+
+// Close closes the underlying file
+func (e *JSONLinesExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.file.Close()
+}
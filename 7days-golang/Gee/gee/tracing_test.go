@@ -0,0 +1,73 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{name: "Valid", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "Future version", value: "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{name: "Empty", value: "", wantErr: true},
+		{name: "Invalid version", value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "Uppercase", value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", wantErr: true},
+		{name: "Zero trace id", value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01", wantErr: true},
+		{name: "Zero span id", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", wantErr: true},
+		{name: "Version 00 too long", value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-x", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTraceparent(%q) error = %v, wantErr: %v", tt.value, err, tt.wantErr)
+			}
+			if err == nil && sc.Traceparent()[3:] != tt.value[3:55] {
+				t.Errorf("Traceparent() = %q, want suffix of %q", sc.Traceparent(), tt.value)
+			}
+		})
+	}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := &InMemoryExporter{}
+	r := New()
+	r.Use(Tracing(exporter))
+	r.GET("/hello/:name", func(c *Context) {
+		_, child := StartSpan(c.Req.Context(), "child")
+		child.Finish()
+		c.String(http.StatusOK, "hello %s", c.Param("name"))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/hello/alice", nil)
+	req.Header.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set(TracestateHeader, "congo=t61rcWkgMzE")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want: 2", len(spans))
+	}
+	child, server := spans[0], spans[1]
+
+	switch {
+	case server.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736":
+		t.Errorf("server span trace id = %s, want the incoming one", server.TraceID)
+	case server.ParentID == nil || server.ParentID.String() != "00f067aa0ba902b7":
+		t.Errorf("server span parent id = %v, want: 00f067aa0ba902b7", server.ParentID)
+	case server.TraceState != "congo=t61rcWkgMzE":
+		t.Errorf("server span trace state = %q", server.TraceState)
+	case server.Attributes["http.route"] != "/hello/:name":
+		t.Errorf("http.route = %v, want: /hello/:name", server.Attributes["http.route"])
+	case server.Attributes["http.status_code"] != http.StatusOK:
+		t.Errorf("http.status_code = %v, want: 200", server.Attributes["http.status_code"])
+	case child.TraceID != server.TraceID || child.ParentID == nil || *child.ParentID != server.SpanID:
+		t.Errorf("child span is not a child of the server span")
+	}
+}
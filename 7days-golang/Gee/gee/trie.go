@@ -71,3 +71,40 @@ func (n *trieNode) search(parts []string, depth int) *trieNode {
 
 	return nil
 }
+
+// 深拷贝以当前节点为根的前缀树
+func (n *trieNode) clone() *trieNode {
+	c := &trieNode{pattern: n.pattern, part: n.part, isWild: n.isWild}
+	if len(n.children) > 0 {
+		c.children = make([]*trieNode, len(n.children))
+		for i, child := range n.children {
+			c.children[i] = child.clone()
+		}
+	}
+	return c
+}
+
+// 删除指定路由，沿插入时的路径查找，并清理空的子节点
+func (n *trieNode) remove(pattern string, parts []string, depth int) bool {
+	if len(parts) == depth {
+		if n.pattern != pattern {
+			return false
+		}
+		n.pattern = ""
+		return true
+	}
+
+	child := n.matchChild(parts[depth])
+	if child == nil || !child.remove(pattern, parts, depth+1) {
+		return false
+	}
+	if child.pattern == "" && len(child.children) == 0 {
+		for i, c := range n.children {
+			if c == child {
+				n.children = append(n.children[:i:i], n.children[i+1:]...)
+				break
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,275 @@
+package gee
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VersionConfig configures how a group negotiates the API version. The
+// version is taken, in this order, from the URL prefix (/v2/...), the
+// Accept header (application/vnd.<vendor>.v2+json) and the custom header.
+type VersionConfig struct {
+	Vendor  string // vendor of the Accept media type, any vendor if empty
+	Header  string // custom request header, default "X-API-Version"
+	Default string // version used if the request asks for none, default the latest
+}
+
+// VersionGroup registers the handlers of one API version. A route missing
+// from a version falls back to the closest older version defining it.
+type VersionGroup struct {
+	set        *versionSet
+	version    string
+	number     []int
+	deprecated time.Time
+	sunset     time.Time
+	handlers   map[string]HandlerFunc // method-pattern -> handler
+}
+
+// VersionOption configures a VersionGroup
+type VersionOption func(v *VersionGroup)
+
+// Deprecated marks the version as deprecated since at, responses served
+// by it carry a Deprecation header
+func Deprecated(at time.Time) VersionOption {
+	return func(v *VersionGroup) {
+		v.deprecated = at
+	}
+}
+
+// Sunset announces when the version will be retired, responses served by
+// it carry a Sunset header
+func Sunset(at time.Time) VersionOption {
+	return func(v *VersionGroup) {
+		v.sunset = at
+	}
+}
+
+// versionSet holds all versions of a RouterGroup
+type versionSet struct {
+	group  *RouterGroup
+	config VersionConfig
+	accept *regexp.Regexp
+
+	mu       sync.RWMutex    // guards the fields below
+	versions []*VersionGroup // sorted by descending version
+	routes   [][2]string     // method, pattern registered on the group
+}
+
+// Versioning configures the version negotiation of the group, call it
+// before Version
+func (group *RouterGroup) Versioning(config VersionConfig) {
+	if config.Header == "" {
+		config.Header = "X-API-Version"
+	}
+	config.Default = strings.TrimPrefix(config.Default, "v")
+	vendor := `[^.+]+`
+	if config.Vendor != "" {
+		vendor = regexp.QuoteMeta(config.Vendor)
+	}
+	group.versions = &versionSet{
+		group:  group,
+		config: config,
+		accept: regexp.MustCompile(`application/vnd\.` + vendor + `\.v(\d+(?:\.\d+)*)\+json`),
+	}
+}
+
+// Version returns the VersionGroup of version, e.g. "2", "2.1" or "v2",
+// creating it if needed
+func (group *RouterGroup) Version(version string, opts ...VersionOption) *VersionGroup {
+	version = strings.TrimPrefix(version, "v")
+	if group.versions == nil {
+		group.Versioning(VersionConfig{})
+	}
+	set := group.versions
+
+	set.mu.Lock()
+	v := set.find(version)
+	created := v == nil
+	if created {
+		number, ok := parseVersion(version)
+		if !ok {
+			set.mu.Unlock()
+			panic("gee: invalid API version: " + version)
+		}
+		v = &VersionGroup{set: set, version: version, number: number, handlers: make(map[string]HandlerFunc)}
+		set.versions = append(set.versions, v)
+		sort.Slice(set.versions, func(i, j int) bool {
+			return compareVersions(set.versions[i].number, set.versions[j].number) > 0
+		})
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	routes := append([][2]string(nil), set.routes...)
+	set.mu.Unlock()
+
+	if created {
+		// make the routes already known reachable under the new prefix
+		for _, route := range routes {
+			group.addRoute(route[0], "/v"+version+route[1], set.dispatch(route[0], route[1], version))
+		}
+	}
+	return v
+}
+
+// Handle registers a handler of this version
+func (v *VersionGroup) Handle(method string, pattern string, handler HandlerFunc) {
+	set := v.set
+
+	set.mu.Lock()
+	v.handlers[method+"-"+pattern] = handler
+	known := false
+	for _, route := range set.routes {
+		if route == [2]string{method, pattern} {
+			known = true
+			break
+		}
+	}
+	var versions []string
+	if !known {
+		set.routes = append(set.routes, [2]string{method, pattern})
+		for _, other := range set.versions {
+			versions = append(versions, other.version)
+		}
+	}
+	set.mu.Unlock()
+
+	if !known {
+		set.group.addRoute(method, pattern, set.dispatch(method, pattern, ""))
+		for _, version := range versions {
+			set.group.addRoute(method, "/v"+version+pattern, set.dispatch(method, pattern, version))
+		}
+	}
+}
+
+func (v *VersionGroup) GET(pattern string, handler HandlerFunc) {
+	v.Handle("GET", pattern, handler)
+}
+
+func (v *VersionGroup) POST(pattern string, handler HandlerFunc) {
+	v.Handle("POST", pattern, handler)
+}
+
+func (v *VersionGroup) PUT(pattern string, handler HandlerFunc) {
+	v.Handle("PUT", pattern, handler)
+}
+
+func (v *VersionGroup) PATCH(pattern string, handler HandlerFunc) {
+	v.Handle("PATCH", pattern, handler)
+}
+
+func (v *VersionGroup) DELETE(pattern string, handler HandlerFunc) {
+	v.Handle("DELETE", pattern, handler)
+}
+
+func (s *versionSet) find(version string) *VersionGroup {
+	for _, v := range s.versions {
+		if v.version == version {
+			return v
+		}
+	}
+	return nil
+}
+
+// dispatch returns the handler of a versioned route, which negotiates the
+// version unless the route carries it in its prefix
+func (s *versionSet) dispatch(method, pattern, pathVersion string) HandlerFunc {
+	key := method + "-" + pattern
+	return func(c *Context) {
+		requested := pathVersion
+		if requested == "" {
+			requested = s.negotiate(c)
+		}
+
+		v, handler := s.resolve(key, requested)
+		header := c.Writer.Header()
+		header.Add("Vary", "Accept")
+		header.Add("Vary", s.config.Header)
+		if handler == nil {
+			c.Fail(http.StatusNotFound, "API version "+requested+" not found")
+			return
+		}
+
+		header.Set(s.config.Header, v.version)
+		if !v.deprecated.IsZero() {
+			header.Set("Deprecation", "@"+strconv.FormatInt(v.deprecated.Unix(), 10))
+		}
+		if !v.sunset.IsZero() {
+			header.Set("Sunset", v.sunset.UTC().Format(http.TimeFormat))
+		}
+		handler(c)
+	}
+}
+
+func (s *versionSet) negotiate(c *Context) string {
+	if m := s.accept.FindStringSubmatch(c.Req.Header.Get("Accept")); m != nil {
+		return m[1]
+	}
+	if version := strings.TrimPrefix(strings.TrimSpace(c.Req.Header.Get(s.config.Header)), "v"); version != "" {
+		return version
+	}
+	return s.config.Default
+}
+
+// resolve finds the newest version not newer than requested which
+// defines the route, requested may be empty for the latest
+func (s *versionSet) resolve(key, requested string) (*VersionGroup, HandlerFunc) {
+	var number []int
+	if requested != "" {
+		var ok bool
+		if number, ok = parseVersion(requested); !ok {
+			return nil, nil
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, v := range s.versions {
+		if number != nil && compareVersions(v.number, number) > 0 {
+			continue
+		}
+		if handler, ok := v.handlers[key]; ok {
+			return v, handler
+		}
+	}
+	return nil, nil
+}
+
+func parseVersion(version string) ([]int, bool) {
+	parts := strings.Split(version, ".")
+	number := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		number[i] = n
+	}
+	return number, true
+}
+
+// compareVersions returns -1, 0 or 1, missing components count as 0
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
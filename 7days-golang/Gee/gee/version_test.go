@@ -0,0 +1,59 @@
+package gee
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVersion(t *testing.T) {
+	r := New()
+	api := r.Group("/api")
+	api.Versioning(VersionConfig{Vendor: "gee", Default: "v1"})
+
+	v1 := api.Version("v1", Deprecated(time.Unix(1700000000, 0)))
+	v1.GET("/users", func(c *Context) {
+		c.String(http.StatusOK, "users v1")
+	})
+	v1.GET("/legacy", func(c *Context) {
+		c.String(http.StatusOK, "legacy v1")
+	})
+	api.Version("2").GET("/users", func(c *Context) {
+		c.String(http.StatusOK, "users v2")
+	})
+	if api.Version("v2") != api.Version("2") {
+		t.Fatal(`Version("v2") and Version("2") differ`)
+	}
+
+	tests := []struct {
+		path, header, value string
+		code                int
+		want, version       string
+	}{
+		{"/api/v2/users", "", "", 200, "users v2", "2"},
+		{"/api/v1/users", "", "", 200, "users v1", "1"},
+		{"/api/v2/legacy", "", "", 200, "legacy v1", "1"},
+		{"/api/users", "", "", 200, "users v1", "1"},
+		{"/api/users", "Accept", "application/vnd.gee.v2+json", 200, "users v2", "2"},
+		{"/api/users", "X-API-Version", "v2", 200, "users v2", "2"},
+		{"/api/users", "X-API-Version", "3", 200, "users v2", "2"},
+		{"/api/users", "X-API-Version", "0.5", 404, "", ""},
+		{"/api/vv2/users", "", "", 404, "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.code || tt.code == 200 && (w.Body.String() != tt.want || w.Header().Get("X-API-Version") != tt.version) {
+			t.Errorf("GET %s %s: %s = %d %q version %q, want %d %q version %q", tt.path, tt.header, tt.value,
+				w.Code, w.Body, w.Header().Get("X-API-Version"), tt.code, tt.want, tt.version)
+		}
+		if deprecated := w.Header().Get("Deprecation") != ""; w.Code == 200 && deprecated != (tt.version == "1") {
+			t.Errorf("GET %s %s: %s: Deprecation = %q", tt.path, tt.header, tt.value, w.Header().Get("Deprecation"))
+		}
+	}
+}
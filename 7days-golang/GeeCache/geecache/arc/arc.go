@@ -0,0 +1,213 @@
+package arc
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Value is the interface of cached values, shared with lru
+type Value = lru.Value
+
+// Cache is an Adaptive Replacement Cache working on bytes. Entries seen
+// once live in t1 and entries seen at least twice in t2, the ghost lists
+// b1 and b2 remember what was evicted from them and move the target size
+// of t1 towards the list whose ghosts are hit. It is not safe for
+// concurrent cases.
+type Cache struct {
+	maxBytes int64
+	p        int64 // target bytes of t1
+	lists    [4]*list.List
+	sizes    [4]int64
+	cache    map[string]*list.Element // resident and ghost entries
+	// optional and executed when an entry is purged
+	OnEvicted func(key string, value Value)
+}
+
+const (
+	t1 = iota // recent, resident
+	t2        // frequent, resident
+	b1        // evicted from t1, key and size only
+	b2        // evicted from t2, key and size only
+)
+
+type entry struct {
+	key    string
+	val    Value
+	expire time.Time // zero means never
+	size   int64
+	list   int
+}
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	c := &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	return c
+}
+
+// Len return the number of cache entries
+func (c *Cache) Len() int {
+	return c.lists[t1].Len() + c.lists[t2].Len()
+}
+
+// Bytes return the size of the cache entries, keys included
+func (c *Cache) Bytes() int64 {
+	return c.sizes[t1] + c.sizes[t2]
+}
+
+// Get find key's value, a hit moves it to the frequent list
+func (c *Cache) Get(key string) (val Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if kv.list == b1 || kv.list == b2 {
+		return nil, false
+	}
+	if !kv.expire.IsZero() && time.Now().After(kv.expire) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	c.move(ele, t2)
+	return kv.val, true
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, val Value) {
+	c.AddWithExpire(key, val, time.Time{})
+}
+
+// AddWithExpire adds a value which expires at expire, the zero time
+// means never
+func (c *Cache) AddWithExpire(key string, val Value, expire time.Time) {
+	size := int64(len(key)) + int64(val.Len())
+	ele, ok := c.cache[key]
+	if !ok {
+		kv := &entry{key: key, val: val, expire: expire, size: size, list: t1}
+		c.cache[key] = c.lists[t1].PushFront(kv)
+		c.sizes[t1] += size
+		c.evict(false)
+		return
+	}
+
+	kv := ele.Value.(*entry)
+	hitB2 := kv.list == b2
+	switch kv.list {
+	case b1:
+		// t1 was too small, grow its target
+		c.p = min64(c.maxBytes, c.p+size*max64(1, c.sizes[b2]/max64(1, c.sizes[b1])))
+	case b2:
+		c.p = max64(0, c.p-size*max64(1, c.sizes[b1]/max64(1, c.sizes[b2])))
+	}
+	c.sizes[kv.list] += size - kv.size
+	kv.val, kv.expire, kv.size = val, expire, size
+	c.move(ele, t2)
+	c.evict(hitB2)
+}
+
+// evict drops resident entries until they fit, then trims the ghosts
+func (c *Cache) evict(hitB2 bool) {
+	for c.maxBytes != 0 && c.Bytes() > c.maxBytes {
+		from := t2
+		if c.lists[t1].Len() > 0 &&
+			(c.sizes[t1] > c.p || (hitB2 && c.sizes[t1] == c.p) || c.lists[t2].Len() == 0) {
+			from = t1
+		}
+		ele := c.lists[from].Back()
+		kv := ele.Value.(*entry)
+		val := kv.val
+		kv.val = nil
+		c.move(ele, from+b1-t1)
+		if c.OnEvicted != nil {
+			c.OnEvicted(kv.key, val)
+		}
+	}
+	for c.maxBytes != 0 && c.sizes[b1]+c.sizes[b2] > c.maxBytes {
+		from := b2
+		if c.sizes[b1] > c.maxBytes-c.p || c.lists[b2].Len() == 0 {
+			from = b1
+		}
+		c.dropGhost(c.lists[from].Back())
+	}
+}
+
+// Remove removes key, it reports whether the key was present
+func (c *Cache) Remove(key string) bool {
+	ele, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	if kv := ele.Value.(*entry); kv.list == b1 || kv.list == b2 {
+		c.dropGhost(ele)
+		return false
+	}
+	c.removeElement(ele)
+	return true
+}
+
+// RemoveExpired removes all the expired entries and returns how many
+// were removed
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, l := range []int{t1, t2} {
+		for ele := c.lists[l].Back(); ele != nil; {
+			prev := ele.Prev()
+			kv := ele.Value.(*entry)
+			if !kv.expire.IsZero() && now.After(kv.expire) {
+				c.removeElement(ele)
+				n++
+			}
+			ele = prev
+		}
+	}
+	return n
+}
+
+// move puts the entry in front of the list to
+func (c *Cache) move(ele *list.Element, to int) {
+	kv := ele.Value.(*entry)
+	c.lists[kv.list].Remove(ele)
+	c.sizes[kv.list] -= kv.size
+	kv.list = to
+	c.cache[kv.key] = c.lists[to].PushFront(kv)
+	c.sizes[to] += kv.size
+}
+
+func (c *Cache) dropGhost(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.lists[kv.list].Remove(ele)
+	c.sizes[kv.list] -= kv.size
+	delete(c.cache, kv.key)
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.lists[kv.list].Remove(ele)
+	c.sizes[kv.list] -= kv.size
+	delete(c.cache, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.val)
+	}
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
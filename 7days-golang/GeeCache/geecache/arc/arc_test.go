@@ -0,0 +1,92 @@
+package arc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (s String) Len() int {
+	return len(s)
+}
+
+func TestGet(t *testing.T) {
+	arc := New(int64(0), nil)
+	arc.Add("key1", String("1234"))
+
+	if v, ok := arc.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Errorf("cache hit key1=1234 failed")
+	}
+
+	if _, ok := arc.Get("key2"); ok {
+		t.Errorf("cache miss key2 failed")
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	evicted := make(map[string]int)
+	// room for ten entries of 5 bytes
+	arc := New(int64(50), func(key string, _ Value) { evicted[key]++ })
+
+	// hot keys are read twice and land in t2
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("h%02d", i)
+		arc.Add(key, String("vv"))
+		arc.Get(key)
+	}
+	for i := 0; i < 100; i++ {
+		arc.Add(fmt.Sprintf("s%02d", i), String("vv"))
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := arc.Get(fmt.Sprintf("h%02d", i)); !ok {
+			t.Fatalf("hot key h%d evicted by a scan", i)
+		}
+	}
+	if arc.Len() != 10 || arc.Bytes() != 50 || len(evicted) != 95 {
+		t.Fatalf("len %d bytes %d evicted %d, want 10, 50 and 95", arc.Len(), arc.Bytes(), len(evicted))
+	}
+	if ghosts := arc.sizes[b1] + arc.sizes[b2]; ghosts > 50 {
+		t.Fatalf("ghosts hold %d bytes, want at most 50", ghosts)
+	}
+}
+
+func TestGhostHit(t *testing.T) {
+	arc := New(int64(20), nil)
+	for i := 0; i < 5; i++ {
+		arc.Add(fmt.Sprintf("k%02d", i), String("vv"))
+	}
+	// k00 was evicted from t1, adding it again grows the target of t1
+	if _, ok := arc.Get("k00"); ok {
+		t.Fatalf("k00 still resident")
+	}
+	arc.Add("k00", String("vv"))
+	if arc.p == 0 {
+		t.Fatalf("ghost hit in b1 didn't grow p")
+	}
+	if kv := arc.cache["k00"].Value.(*entry); kv.list != t2 {
+		t.Fatalf("k00 added back into list %d, want t2", kv.list)
+	}
+	if arc.Bytes() != 20 {
+		t.Fatalf("bytes %d, want 20", arc.Bytes())
+	}
+}
+
+func TestBytes(t *testing.T) {
+	evicted := 0
+	arc := New(int64(0), func(string, Value) { evicted++ })
+	arc.Add("key1", String("1234"))
+	arc.Add("key1", String("123456"))
+	arc.AddWithExpire("key2", String("12"), time.Now().Add(-time.Second))
+	if arc.Bytes() != int64(len("key1123456key212")) {
+		t.Fatalf("bytes %d after update", arc.Bytes())
+	}
+
+	if n := arc.RemoveExpired(); n != 1 || arc.Bytes() != int64(len("key1123456")) {
+		t.Fatalf("RemoveExpired removed %d, bytes %d", n, arc.Bytes())
+	}
+	if !arc.Remove("key1") || arc.Bytes() != 0 || arc.Len() != 0 || evicted != 2 {
+		t.Fatalf("bytes %d len %d evicted %d after Remove", arc.Bytes(), arc.Len(), evicted)
+	}
+}
@@ -1,10 +1,14 @@
 package geecache
 
-import "geecache/lru"
+import (
+	"geecache/lru"
+	"time"
+)
 
 // ByteView holds an immutable view of bytes
 type ByteView struct {
 	b []byte
+	e time.Time // expiration, zero means never
 }
 
 var _ = lru.Value(ByteView{})
@@ -14,6 +18,11 @@ func (v ByteView) Len() int {
 	return len(v.b)
 }
 
+// Expire returns the time the view expires, the zero time means never
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
 // ByteSlice returns a copy of the data as byte slice
 func (v ByteView) ByteSlice() []byte {
 	return cloneBytes(v.b)
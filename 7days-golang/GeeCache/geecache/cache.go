@@ -7,31 +7,179 @@ import (
 
 type cache struct {
 	mu         sync.Mutex
-	lru        *lru.Cache
+	policy     EvictionPolicy
+	newPolicy  PolicyFactory // defaults to LRU
 	cacheBytes int64
+	nget, nhit int64
+	nevict     int64 // entries dropped for room or expiration
 }
 
+// CacheStats are the statistics of one of the caches of a Group
+type CacheStats struct {
+	Bytes     int64 `json:"bytes"`
+	Items     int64 `json:"items"`
+	Gets      int64 `json:"gets"`
+	Hits      int64 `json:"hits"`
+	Evictions int64 `json:"evictions"`
+}
+
+// CacheType selects the cache of a Group to report stats for
+type CacheType int
+
+const (
+	// MainCache holds the keys this peer owns
+	MainCache CacheType = iota + 1
+	// HotCache holds copies of popular keys owned by other peers
+	HotCache
+)
+
 func (c *cache) add(key string, val ByteView) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	if c.policy == nil {
+		newPolicy := c.newPolicy
+		if newPolicy == nil {
+			newPolicy = LRU
+		}
+		c.policy = newPolicy(c.cacheBytes, func(string, lru.Value) {
+			c.nevict++
+		})
 	}
-	c.lru.Add(key, val)
+	c.policy.AddWithExpire(key, val, val.e)
 }
 
 func (c *cache) get(key string) (ByteView, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.lru == nil {
+	c.nget++
+	if c.policy == nil {
 		return ByteView{}, false
 	}
 
-	if v, ok := c.lru.Get(key); ok {
+	if v, ok := c.policy.Get(key); ok {
+		c.nhit++
 		return v.(ByteView), ok
 	}
 
 	return ByteView{}, false
 }
+
+// removeExpired drops the expired entries, returning how many
+func (c *cache) removeExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.policy == nil {
+		return 0
+	}
+	return c.policy.RemoveExpired()
+}
+
+func (c *cache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.policy != nil {
+		nevict := c.nevict
+		c.policy.Remove(key)
+		c.nevict = nevict // explicit removals are not evictions
+	}
+}
+
+func (c *cache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.policy = nil
+}
+
+func (c *cache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := CacheStats{Gets: c.nget, Hits: c.nhit, Evictions: c.nevict}
+	if c.policy != nil {
+		s.Bytes = c.policy.Bytes()
+		s.Items = int64(c.policy.Len())
+	}
+	return s
+}
+
+// shardedCache spreads the keys over independently locked caches, each
+// with an equal share of the byte budget, to reduce lock contention
+type shardedCache struct {
+	shards []*cache
+}
+
+func newShardedCache(n int, cacheBytes int64, newPolicy PolicyFactory) *shardedCache {
+	if n < 1 {
+		n = 1
+	}
+	sc := &shardedCache{shards: make([]*cache, n)}
+	for i := range sc.shards {
+		// 0 is unlimited, a limited shard must keep at least a byte
+		bytes := cacheBytes / int64(n)
+		if int64(i) < cacheBytes%int64(n) {
+			bytes++
+		}
+		if cacheBytes > 0 && bytes == 0 {
+			bytes = 1
+		}
+		sc.shards[i] = &cache{cacheBytes: bytes, newPolicy: newPolicy}
+	}
+	return sc
+}
+
+func (sc *shardedCache) shard(key string) *cache {
+	if len(sc.shards) == 1 {
+		return sc.shards[0]
+	}
+	// inlined FNV-1a, hash/fnv would need a []byte copy of the key
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return sc.shards[h%uint32(len(sc.shards))]
+}
+
+func (sc *shardedCache) add(key string, val ByteView) {
+	sc.shard(key).add(key, val)
+}
+
+func (sc *shardedCache) get(key string) (ByteView, bool) {
+	return sc.shard(key).get(key)
+}
+
+func (sc *shardedCache) remove(key string) {
+	sc.shard(key).remove(key)
+}
+
+func (sc *shardedCache) removeExpired() int {
+	n := 0
+	for _, c := range sc.shards {
+		n += c.removeExpired()
+	}
+	return n
+}
+
+func (sc *shardedCache) purge() {
+	for _, c := range sc.shards {
+		c.purge()
+	}
+}
+
+func (sc *shardedCache) stats() CacheStats {
+	var s CacheStats
+	for _, c := range sc.shards {
+		cs := c.stats()
+		s.Bytes += cs.Bytes
+		s.Items += cs.Items
+		s.Gets += cs.Gets
+		s.Hits += cs.Hits
+		s.Evictions += cs.Evictions
+	}
+	return s
+}
@@ -0,0 +1,95 @@
+package geecache
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShardedCache(t *testing.T) {
+	sc := newShardedCache(4, 4<<10, nil)
+	for i := 0; i < 100; i++ {
+		sc.add(fmt.Sprintf("key%d", i), ByteView{b: []byte("value")})
+	}
+	for i := 0; i < 100; i++ {
+		if v, ok := sc.get(fmt.Sprintf("key%d", i)); !ok || v.String() != "value" {
+			t.Fatalf("key%d = %q, %v", i, v, ok)
+		}
+	}
+	if s := sc.stats(); s.Items != 100 || s.Hits != 100 {
+		t.Fatalf("stats %+v, want 100 items and hits", s)
+	}
+	for _, c := range sc.shards {
+		if c.cacheBytes != 1<<10 || c.stats().Items == 0 {
+			t.Fatalf("unbalanced shard: budget %d, stats %+v", c.cacheBytes, c.stats())
+		}
+	}
+
+	sc.remove("key0")
+	if _, ok := sc.get("key0"); ok {
+		t.Fatalf("key0 still cached after remove")
+	}
+	sc.purge()
+	if s := sc.stats(); s.Items != 0 {
+		t.Fatalf("%d items after purge", s.Items)
+	}
+	// the budget is split exactly and never becomes unlimited
+	for _, tt := range []struct{ n, bytes int64 }{{4, 10}, {8, 3}} {
+		sc := newShardedCache(int(tt.n), tt.bytes, nil)
+		total := int64(0)
+		for _, c := range sc.shards {
+			if c.cacheBytes == 0 {
+				t.Fatalf("unlimited shard out of %d bytes", tt.bytes)
+			}
+			total += c.cacheBytes
+		}
+		if want := max64(tt.n, tt.bytes); total != want {
+			t.Fatalf("%d shards of %d bytes hold %d bytes, want %d", tt.n, tt.bytes, total, want)
+		}
+	}
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// benchmarkCache runs a read-mostly workload, one add per 10 gets, from
+// all the benchmark goroutines
+func benchmarkCache(b *testing.B, shards int) {
+	const keys = 1 << 12
+	sc := newShardedCache(shards, 1<<20, nil)
+	names := make([]string, keys)
+	for i := range names {
+		names[i] = fmt.Sprintf("key%d", i)
+		sc.add(names[i], ByteView{b: []byte("value")})
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := names[i%keys]
+			if i%10 == 0 {
+				sc.add(key, ByteView{b: []byte("value")})
+			} else {
+				sc.get(key)
+			}
+			i += 7
+		}
+	})
+}
+
+func BenchmarkCache(b *testing.B) {
+	benchmarkCache(b, 1)
+}
+
+func BenchmarkShardedCache(b *testing.B) {
+	for _, shards := range []int{4, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			benchmarkCache(b, shards)
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package consistenthash
+
+import "math"
+
+// LoadPicker is a Picker which counts the load of each node: every key
+// returned by Get weighs on its node until Done is called
+type LoadPicker interface {
+	Picker
+	Done(node string)
+}
+
+const defaultLoadFactor = 1.25
+
+var _ LoadPicker = (*Bounded)(nil)
+
+// Bounded implements consistent hashing with bounded loads. A node takes
+// a key only while its load is under c times its share of the total
+// load, otherwise the key goes on to the next nodes of the ring. Keys
+// spread a bit more, but no node gets far more than the others. The
+// loads are only right when a single Bounded sees every key, as in a
+// proxy in front of the nodes.
+type Bounded struct {
+	*Map
+	c     float64
+	loads map[string]int64
+	total int64
+}
+
+// NewBounded creates a Bounded with the load factor c, which must be
+// above 1. It defaults to 1.25.
+func NewBounded(replicas int, fn Hash, c float64) *Bounded {
+	if c <= 1 {
+		c = defaultLoadFactor
+	}
+	return &Bounded{
+		Map:   New(replicas, fn),
+		c:     c,
+		loads: make(map[string]int64),
+	}
+}
+
+// Get returns the first node of the ring after key with room left, and
+// counts the key on it
+func (b *Bounded) Get(key string) string {
+	if len(b.keys) == 0 {
+		return ""
+	}
+	var weights int
+	for _, w := range b.weights {
+		weights += w
+	}
+	// the capacities add up to more than the new total, one has room
+	idx := b.search(key)
+	for i := 0; i < len(b.keys); i++ {
+		node := b.hashMap[b.keys[(idx+i)%len(b.keys)]][0]
+		limit := math.Ceil(b.c * float64(b.total+1) * float64(b.weights[node]) / float64(weights))
+		if float64(b.loads[node]) < limit {
+			b.loads[node]++
+			b.total++
+			return node
+		}
+	}
+	return ""
+}
+
+// Done releases a key of node
+func (b *Bounded) Done(node string) {
+	if b.loads[node] > 0 {
+		b.loads[node]--
+		b.total--
+	}
+}
+
+// Load returns the number of keys counted on node
+func (b *Bounded) Load(node string) int64 {
+	return b.loads[node]
+}
+
+// Remove removes nodes and forgets their loads
+func (b *Bounded) Remove(nodes ...string) {
+	b.Map.Remove(nodes...)
+	for _, node := range nodes {
+		b.total -= b.loads[node]
+		delete(b.loads, node)
+	}
+}
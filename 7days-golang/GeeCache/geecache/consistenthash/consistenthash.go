@@ -9,12 +9,31 @@ import (
 // Hash maps bytes to uint32
 type Hash func(data []byte) uint32
 
+// Picker maps keys to nodes, it's implemented by every algorithm of this
+// package. Pickers are not safe for concurrent use.
+type Picker interface {
+	// Add adds nodes with weight 1
+	Add(nodes ...string)
+	// AddWeighted adds a node which gets about weight times the keys of
+	// a node of weight 1, adding a node again updates its weight
+	AddWeighted(node string, weight int)
+	// Remove removes nodes, their keys move to the remaining ones
+	Remove(nodes ...string)
+	// Get returns the node of key, or "" if there's none
+	Get(key string) string
+}
+
+var _ Picker = (*Map)(nil)
+
 // Map contains all hashed keys
 type Map struct {
 	hash     Hash
 	replicas int
 	keys     []int // sorted in increasing order
-	hashMap  map[int]string
+	// nodes sharing a hash are sorted, the first one wins, so that the
+	// owner doesn't depend on the order nodes were added in
+	hashMap map[int][]string
+	weights map[string]int
 }
 
 // New creates a Map instance
@@ -22,7 +41,8 @@ func New(replicas int, fn Hash) *Map {
 	m := &Map{
 		replicas: replicas,
 		hash:     fn,
-		hashMap:  make(map[int]string),
+		hashMap:  make(map[int][]string),
+		weights:  make(map[string]int),
 	}
 	if m.hash == nil {
 		m.hash = crc32.ChecksumIEEE
@@ -33,26 +53,102 @@ func New(replicas int, fn Hash) *Map {
 // Add adds keys to the hash
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		m.AddWeighted(key, 1)
+	}
+}
+
+// AddWeighted adds key with weight times the replicas
+func (m *Map) AddWeighted(key string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	if _, ok := m.weights[key]; ok {
+		m.Remove(key)
+	}
+	m.weights[key] = weight
+	for i := 0; i < m.replicas*weight; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		owners, ok := m.hashMap[hash]
+		if !ok {
 			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
 		}
+		m.hashMap[hash] = insertSorted(owners, key)
 	}
 	sort.Ints(m.keys)
 }
 
+// Remove removes keys from the hash
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		weight, ok := m.weights[key]
+		if !ok {
+			continue
+		}
+		delete(m.weights, key)
+		for i := 0; i < m.replicas*weight; i++ {
+			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+			if owners := removeSorted(m.hashMap[hash], key); len(owners) > 0 {
+				m.hashMap[hash] = owners
+			} else {
+				delete(m.hashMap, hash)
+			}
+		}
+	}
+
+	kept := m.keys[:0]
+	for _, hash := range m.keys {
+		if _, ok := m.hashMap[hash]; ok {
+			kept = append(kept, hash)
+		}
+	}
+	m.keys = kept
+}
+
 // Get gets the closest item in the hash to the provided key
 func (m *Map) Get(key string) string {
 	if len(m.keys) == 0 {
 		return ""
 	}
+	return m.hashMap[m.keys[m.search(key)]][0]
+}
 
+// search returns the index of the first replica at or after key
+func (m *Map) search(key string) int {
 	hash := int(m.hash([]byte(key)))
 	// Binary search for appropriate replica
 	idx := sort.Search(len(m.keys), func(i int) bool {
 		return m.keys[i] >= hash
 	})
+	return idx % len(m.keys)
+}
+
+// insertSorted inserts s into the sorted ss unless it's there already
+func insertSorted(ss []string, s string) []string {
+	i := sort.SearchStrings(ss, s)
+	if i < len(ss) && ss[i] == s {
+		return ss
+	}
+	ss = append(ss, "")
+	copy(ss[i+1:], ss[i:])
+	ss[i] = s
+	return ss
+}
+
+func removeSorted(ss []string, s string) []string {
+	i := sort.SearchStrings(ss, s)
+	if i < len(ss) && ss[i] == s {
+		return append(ss[:i], ss[i+1:]...)
+	}
+	return ss
+}
 
-	return m.hashMap[m.keys[idx%len(m.keys)]]
+// mix is the finalizer of splitmix64. CRC32 is linear, so the hashes of
+// a key and a node are mixed before being compared or reduced.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
 }
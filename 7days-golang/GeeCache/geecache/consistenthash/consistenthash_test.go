@@ -38,3 +38,139 @@ func TestHash(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(data []byte) uint32 {
+		i, _ := strconv.Atoi(string(data))
+		return uint32(i)
+	})
+	hash.Add("6", "4", "2")
+
+	// without 2, its replicas 2, 12, 22 go to the next ones
+	hash.Remove("2")
+	tests := map[string]string{
+		"2":  "4",
+		"11": "4",
+		"23": "4",
+		"27": "4",
+	}
+	for k, v := range tests {
+		if got := hash.Get(k); got != v {
+			t.Errorf("Get(%q) = %v, want: %v", k, got, v)
+		}
+	}
+
+	hash.Remove("4", "6")
+	if got := hash.Get("2"); got != "" || len(hash.keys) != 0 {
+		t.Errorf("Get on an empty hash = %q with %d keys", got, len(hash.keys))
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// every replica of every node collides
+	same := func([]byte) uint32 { return 42 }
+	a, b := New(3, same), New(3, same)
+	a.Add("x", "y")
+	b.Add("y", "x")
+	if a.Get("key") != "x" || b.Get("key") != "x" {
+		t.Fatalf("owner depends on the order of Add: %q, %q", a.Get("key"), b.Get("key"))
+	}
+	a.Remove("x")
+	if got := a.Get("key"); got != "y" {
+		t.Fatalf("Get = %q after removing x, want y", got)
+	}
+}
+
+// pickers returns an instance of each algorithm
+func pickers() map[string]Picker {
+	return map[string]Picker{
+		"map":        New(50, nil),
+		"bounded":    NewBounded(50, nil, 0),
+		"rendezvous": NewRendezvous(nil),
+		"jump":       NewJump(nil),
+		"maglev":     NewMaglev(0, nil),
+	}
+}
+
+func TestPickers(t *testing.T) {
+	const keys = 10000
+	for name, p := range pickers() {
+		p.Add("a", "b", "c")
+		p.AddWeighted("d", 2)
+		counts := make(map[string]int)
+		owners := make(map[string]string, keys)
+		for i := 0; i < keys; i++ {
+			key := strconv.Itoa(i)
+			owners[key] = p.Get(key)
+			counts[owners[key]]++
+		}
+		// d should get about 2/5 of the keys, the others 1/5
+		for node, want := range map[string]int{"a": 2000, "b": 2000, "c": 2000, "d": 4000} {
+			if got := counts[node]; got < want*6/10 || got > want*14/10 {
+				t.Errorf("%s: %s got %d keys, want about %d", name, node, got, want)
+			}
+		}
+		if lp, ok := p.(LoadPicker); ok {
+			for key, node := range owners {
+				lp.Done(node)
+				delete(owners, key)
+			}
+			continue
+		}
+
+		// removing the last node moves its own keys, Maglev moves a few
+		// more
+		p.Remove("d")
+		moved := 0
+		for key, node := range owners {
+			if got := p.Get(key); node != "d" && got != node {
+				moved++
+			}
+		}
+		if moved > keys/100 {
+			t.Errorf("%s: %d keys of other nodes moved when d left", name, moved)
+		}
+	}
+}
+
+func TestBounded(t *testing.T) {
+	b := NewBounded(50, nil, 1.25)
+	b.Add("a", "b", "c", "d")
+	// a single hot key would all go to one node without bounds
+	for i := 0; i < 100; i++ {
+		b.Get("hot")
+	}
+	for _, node := range []string{"a", "b", "c", "d"} {
+		if load := b.Load(node); load > 32 {
+			t.Errorf("%s has load %d, want at most 32", node, load)
+		}
+	}
+
+	owner := New(50, nil)
+	owner.Add("a", "b", "c", "d")
+	hot := owner.Get("hot")
+	for i := 0; i < 100; i++ {
+		b.Done(hot)
+	}
+	if load := b.Load(hot); load != 0 {
+		t.Fatalf("%s has load %d after Done, want 0", hot, load)
+	}
+	if got := b.Get("hot"); got != hot {
+		t.Fatalf("Get(hot) = %s once loads are back down, want %s", got, hot)
+	}
+}
+
+func TestMaglevSize(t *testing.T) {
+	m := NewMaglev(31, nil)
+	m.Add("a", "b", "c")
+	if m.Get("key") == "" {
+		t.Fatal("no node for key")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("NewMaglev accepted 36 slots")
+		}
+	}()
+	NewMaglev(36, nil)
+}
@@ -0,0 +1,86 @@
+package consistenthash
+
+import "hash/crc32"
+
+var _ Picker = (*Jump)(nil)
+
+// Jump implements jump consistent hashing ("A Fast, Minimal Memory,
+// Consistent Hash Algorithm", Lamping and Veach). It needs no memory
+// besides the list of buckets, but buckets are numbered: only adding or
+// removing the last node moves the minimal number of keys, removing
+// another one shifts the buckets after it. Nodes which must agree on the
+// mapping have to add the same nodes in the same order.
+type Jump struct {
+	hash    Hash
+	buckets []string // a node of weight w has w buckets
+	weights map[string]int
+}
+
+// NewJump creates a Jump instance
+func NewJump(fn Hash) *Jump {
+	j := &Jump{
+		hash:    fn,
+		weights: make(map[string]int),
+	}
+	if j.hash == nil {
+		j.hash = crc32.ChecksumIEEE
+	}
+	return j
+}
+
+// Add appends nodes with weight 1
+func (j *Jump) Add(nodes ...string) {
+	for _, node := range nodes {
+		j.AddWeighted(node, 1)
+	}
+}
+
+// AddWeighted appends weight buckets for node, the node is removed
+// first if it's already there
+func (j *Jump) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	if _, ok := j.weights[node]; ok {
+		j.Remove(node)
+	}
+	j.weights[node] = weight
+	for i := 0; i < weight; i++ {
+		j.buckets = append(j.buckets, node)
+	}
+}
+
+// Remove removes the buckets of nodes
+func (j *Jump) Remove(nodes ...string) {
+	removed := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		removed[node] = true
+		delete(j.weights, node)
+	}
+	kept := j.buckets[:0]
+	for _, node := range j.buckets {
+		if !removed[node] {
+			kept = append(kept, node)
+		}
+	}
+	j.buckets = kept
+}
+
+// Get returns the node of the bucket key jumps to
+func (j *Jump) Get(key string) string {
+	if len(j.buckets) == 0 {
+		return ""
+	}
+	return j.buckets[jump(mix(uint64(j.hash([]byte(key)))), len(j.buckets))]
+}
+
+// jump returns the bucket of key among n
+func jump(key uint64, n int) int {
+	var b, i int64 = -1, 0
+	for i < int64(n) {
+		b = i
+		key = key*2862933555777941757 + 1
+		i = int64(float64(b+1) * (float64(1<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
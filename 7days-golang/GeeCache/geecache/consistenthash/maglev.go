@@ -0,0 +1,131 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"sort"
+)
+
+// DefaultMaglevSize is the default size of the lookup table, it must be
+// a prime well above the number of nodes
+const DefaultMaglevSize = 65537
+
+var _ Picker = (*Maglev)(nil)
+
+// Maglev implements the consistent hashing of Google's Maglev load
+// balancer. Nodes take turns filling a lookup table, each following its
+// own permutation of the slots, so Get is a single lookup and the nodes
+// get almost the same number of slots. The table is built again on the
+// first Get after a change.
+type Maglev struct {
+	hash    Hash
+	size    uint64
+	weights map[string]int
+	table   []string
+}
+
+// NewMaglev creates a Maglev instance with a table of size slots, size
+// defaults to DefaultMaglevSize. It panics if size isn't prime, the
+// permutations of the nodes wouldn't cover the table.
+func NewMaglev(size int, fn Hash) *Maglev {
+	if size <= 0 {
+		size = DefaultMaglevSize
+	}
+	if !isPrime(size) {
+		panic("consistenthash: Maglev table size must be prime")
+	}
+	m := &Maglev{
+		hash:    fn,
+		size:    uint64(size),
+		weights: make(map[string]int),
+	}
+	if m.hash == nil {
+		m.hash = crc32.ChecksumIEEE
+	}
+	return m
+}
+
+// Add adds nodes with weight 1
+func (m *Maglev) Add(nodes ...string) {
+	for _, node := range nodes {
+		m.AddWeighted(node, 1)
+	}
+}
+
+// AddWeighted adds or updates a node, it fills weight slots per turn
+func (m *Maglev) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	m.weights[node] = weight
+	m.table = nil
+}
+
+// Remove removes nodes
+func (m *Maglev) Remove(nodes ...string) {
+	for _, node := range nodes {
+		delete(m.weights, node)
+	}
+	m.table = nil
+}
+
+// Get looks key up in the table
+func (m *Maglev) Get(key string) string {
+	if len(m.weights) == 0 {
+		return ""
+	}
+	if m.table == nil {
+		m.populate()
+	}
+	return m.table[mix(uint64(m.hash([]byte(key))))%m.size]
+}
+
+func (m *Maglev) populate() {
+	// sorted so that the table doesn't depend on the order of additions
+	nodes := make([]string, 0, len(m.weights))
+	for node := range m.weights {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	offsets := make([]uint64, len(nodes))
+	skips := make([]uint64, len(nodes))
+	next := make([]uint64, len(nodes))
+	for i, node := range nodes {
+		h := mix(uint64(m.hash([]byte(node))))
+		offsets[i] = (h & 0xffffffff) % m.size
+		skips[i] = (h>>32)%(m.size-1) + 1
+	}
+
+	table := make([]string, m.size)
+	filled := uint64(0)
+	for {
+		for i, node := range nodes {
+			for w := 0; w < m.weights[node]; w++ {
+				// the next free slot of the node's permutation
+				slot := (offsets[i] + next[i]*skips[i]) % m.size
+				for table[slot] != "" {
+					next[i]++
+					slot = (offsets[i] + next[i]*skips[i]) % m.size
+				}
+				table[slot] = node
+				next[i]++
+				if filled++; filled == m.size {
+					m.table = table
+					return
+				}
+			}
+		}
+	}
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for i := 2; i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
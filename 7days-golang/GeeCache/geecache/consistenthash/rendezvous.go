@@ -0,0 +1,77 @@
+package consistenthash
+
+import (
+	"hash/crc32"
+	"math"
+)
+
+var _ Picker = (*Rendezvous)(nil)
+
+// Rendezvous implements rendezvous or highest random weight hashing:
+// every node scores the key and the highest score wins. Get is linear
+// in the number of nodes, but there's no ring to keep and the keys are
+// spread evenly.
+type Rendezvous struct {
+	hash  Hash
+	nodes map[string]rendezvousNode
+}
+
+type rendezvousNode struct {
+	hash   uint64
+	weight float64
+}
+
+// NewRendezvous creates a Rendezvous instance
+func NewRendezvous(fn Hash) *Rendezvous {
+	r := &Rendezvous{
+		hash:  fn,
+		nodes: make(map[string]rendezvousNode),
+	}
+	if r.hash == nil {
+		r.hash = crc32.ChecksumIEEE
+	}
+	return r
+}
+
+// Add adds nodes with weight 1
+func (r *Rendezvous) Add(nodes ...string) {
+	for _, node := range nodes {
+		r.AddWeighted(node, 1)
+	}
+}
+
+// AddWeighted adds or updates a node
+func (r *Rendezvous) AddWeighted(node string, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	r.nodes[node] = rendezvousNode{
+		hash:   uint64(r.hash([]byte(node))) << 32,
+		weight: float64(weight),
+	}
+}
+
+// Remove removes nodes
+func (r *Rendezvous) Remove(nodes ...string) {
+	for _, node := range nodes {
+		delete(r.nodes, node)
+	}
+}
+
+// Get returns the node with the highest score for key
+func (r *Rendezvous) Get(key string) string {
+	h := uint64(r.hash([]byte(key)))
+	var (
+		best  string
+		score = math.Inf(-1)
+	)
+	for node, n := range r.nodes {
+		// weighted scores are -w / ln(u) with u uniform in (0, 1)
+		u := (float64(mix(n.hash|h)>>11) + 0.5) / (1 << 53)
+		s := -n.weight / math.Log(u)
+		if s > score || s == score && node < best {
+			best, score = node, s
+		}
+	}
+	return best
+}
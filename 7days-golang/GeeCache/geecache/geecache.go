@@ -1,11 +1,15 @@
 package geecache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	pb "geecache/geecachepb"
 	"geecache/singleflight"
 	"log"
+	"math/rand"
 	"sync"
+	"time"
 )
 
 // Getter loads data for a key
@@ -23,24 +27,164 @@ func (f GetterFunc) Get(key string) ([]byte, error) {
 	return f(key)
 }
 
+// GetterWithContext loads data for a key, giving up once ctx is done. It
+// takes precedence over GetterWithExpire, implement GetterWithExpireContext
+// to get both.
+type GetterWithContext interface {
+	GetContext(ctx context.Context, key string) ([]byte, error)
+}
+
+var (
+	_ Getter            = GetterWithContextFunc(nil)
+	_ GetterWithContext = GetterWithContextFunc(nil)
+)
+
+// GetterWithContextFunc implements Getter and GetterWithContext with a
+// function, so it can be passed to NewGroup
+type GetterWithContextFunc func(ctx context.Context, key string) ([]byte, error)
+
+// Get implements Getter interface
+func (f GetterWithContextFunc) Get(key string) ([]byte, error) {
+	return f(context.Background(), key)
+}
+
+// GetContext implements GetterWithContext interface
+func (f GetterWithContextFunc) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+// GetterWithExpire loads data for a key along with the time it expires,
+// the zero time falls back to the group's TTL
+type GetterWithExpire interface {
+	GetWithExpire(key string) ([]byte, time.Time, error)
+}
+
+var (
+	_ Getter           = GetterWithExpireFunc(nil)
+	_ GetterWithExpire = GetterWithExpireFunc(nil)
+)
+
+// GetterWithExpireFunc implements Getter and GetterWithExpire with a
+// function, so it can be passed to NewGroup
+type GetterWithExpireFunc func(key string) ([]byte, time.Time, error)
+
+// Get implements Getter interface
+func (f GetterWithExpireFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(key)
+	return b, err
+}
+
+// GetWithExpire implements GetterWithExpire interface
+func (f GetterWithExpireFunc) GetWithExpire(key string) ([]byte, time.Time, error) {
+	return f(key)
+}
+
+// GetterWithExpireContext loads data for a key along with the time it
+// expires, giving up once ctx is done. It takes precedence over the other
+// getters.
+type GetterWithExpireContext interface {
+	GetWithExpireContext(ctx context.Context, key string) ([]byte, time.Time, error)
+}
+
+var (
+	_ Getter                  = GetterWithExpireContextFunc(nil)
+	_ GetterWithExpireContext = GetterWithExpireContextFunc(nil)
+)
+
+// GetterWithExpireContextFunc implements Getter and GetterWithExpireContext
+// with a function, so it can be passed to NewGroup
+type GetterWithExpireContextFunc func(ctx context.Context, key string) ([]byte, time.Time, error)
+
+// Get implements Getter interface
+func (f GetterWithExpireContextFunc) Get(key string) ([]byte, error) {
+	b, _, err := f(context.Background(), key)
+	return b, err
+}
+
+// GetWithExpireContext implements GetterWithExpireContext interface
+func (f GetterWithExpireContextFunc) GetWithExpireContext(ctx context.Context, key string) ([]byte, time.Time, error) {
+	return f(ctx, key)
+}
+
 // Group is a cache namespace and associated data loaded spread over
 type Group struct {
 	name      string
 	getter    Getter
-	mainCache cache
-	peers     PeerPicker
+	mainCache *shardedCache
+	// hotCache holds copies of keys owned by other peers, which are
+	// popular enough to be worth saving a round trip
+	hotCache cache
+	peers    PeerPicker
 	// use singleflight.Group to make sure that
 	// each key is only fetched once
 	loader *singleflight.Group
+	// default time to live of the entries, zero means forever
+	ttl           time.Duration
+	sweepInterval time.Duration
+	stop          chan struct{}
+	closeOnce     sync.Once
+	// send invalidations to every peer, not only to the owner
+	broadcast bool
+	stats     groupStats
+	policy    PolicyFactory
+	shards    int
+}
+
+// GroupOption configures a Group created by NewGroup
+type GroupOption func(*Group)
+
+// WithTTL sets the default time to live of the loaded entries
+func WithTTL(ttl time.Duration) GroupOption {
+	return func(g *Group) {
+		g.ttl = ttl
+	}
+}
+
+// WithHotCacheBytes sets the budget of the hot cache, it defaults to an
+// eighth of the main cache budget, and zero or less disables it
+func WithHotCacheBytes(n int64) GroupOption {
+	return func(g *Group) {
+		g.hotCache.cacheBytes = n
+	}
+}
+
+// WithShards splits the main cache into n shards, each locked on its own
+// and holding 1/n of the budget. It defaults to a single shard.
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.shards = n
+	}
 }
 
+// WithBroadcastInvalidation makes Set and Remove drop the key on every
+// peer, so that copies held by non-owners don't outlive the change. The
+// PeerPicker must implement PeerLister.
+func WithBroadcastInvalidation() GroupOption {
+	return func(g *Group) {
+		g.broadcast = true
+	}
+}
+
+// WithSweepInterval sets how often expired entries are removed in the
+// background, it defaults to one minute when entries may expire
+func WithSweepInterval(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.sweepInterval = d
+	}
+}
+
+// hotCacheRatio is the inverse probability of a peer response being
+// copied into the hot cache
+const hotCacheRatio = 10
+
 var (
 	mu     sync.RWMutex
 	groups = make(map[string]*Group)
 )
 
-// NewGroup create a new instance of group
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+// NewGroup create a new instance of group, it replaces and closes the
+// group of the same name if there's one
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
@@ -49,15 +193,54 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 	defer mu.Unlock()
 
 	g := &Group{
-		name:      name,
-		getter:    getter,
-		mainCache: cache{cacheBytes: cacheBytes},
-		loader:    &singleflight.Group{},
+		name:     name,
+		getter:   getter,
+		hotCache: cache{cacheBytes: cacheBytes / 8},
+		loader:   &singleflight.Group{},
+		stop:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.mainCache = newShardedCache(g.shards, cacheBytes, g.policy)
+	g.hotCache.newPolicy = g.policy
+	_, expires := getter.(GetterWithExpire)
+	if g.sweepInterval == 0 && (g.ttl > 0 || expires) {
+		g.sweepInterval = time.Minute
+	}
+	if g.sweepInterval > 0 {
+		go g.sweep()
+	}
+	if old, ok := groups[name]; ok {
+		old.Close()
 	}
 	groups[name] = g
 	return g
 }
 
+// sweep removes the expired entries periodically, so that entries which
+// are never read again don't hold the cache bytes
+func (g *Group) sweep() {
+	ticker := time.NewTicker(g.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.mainCache.removeExpired()
+			g.hotCache.removeExpired()
+		case <-g.stop:
+			return
+		}
+	}
+}
+
+// Close stops the background sweeper of the group
+func (g *Group) Close() {
+	g.closeOnce.Do(func() {
+		close(g.stop)
+	})
+}
+
 // GetGroup returns the named group previously created with NewGroup, or
 // nil if there's no such group.
 func GetGroup(name string) *Group {
@@ -77,32 +260,176 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 }
 
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, but gives up once ctx is done. The load it
+// started, if any, goes on for the other callers.
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
 	if key == "" {
 		return ByteView{}, fmt.Errorf("key is required")
 	}
 
+	g.stats.gets.Add(1)
 	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[GeeCache] hit")
+		g.stats.hits.Add(1)
+		return v, nil
+	}
+	if v, ok := g.hotCache.get(key); ok {
+		g.stats.hits.Add(1)
 		return v, nil
 	}
 
-	return g.load(key)
+	return g.load(ctx, key)
+}
+
+// Set stores value for key on the peer owning it, the zero expire means
+// the group's TTL
+func (g *Group) Set(key string, value []byte, expire time.Time) error {
+	return g.SetContext(context.Background(), key, value, expire)
+}
+
+// SetContext is like Set, but gives up once ctx is done
+func (g *Group) SetContext(ctx context.Context, key string, value []byte, expire time.Time) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+
+	owner, remote := g.pickPeer(key)
+	if remote {
+		req := &pb.Request{Group: g.name, Key: key}
+		if err := owner.Set(ctx, req, value, expire); err != nil {
+			return err
+		}
+		// a stale copy might be held here
+		g.removeLocally(key)
+	} else {
+		g.populateCache(key, ByteView{b: cloneBytes(value), e: g.expireAt(expire)})
+	}
+	return g.invalidate(ctx, key, owner)
+}
+
+// Remove drops key from the cache of the peer owning it
+func (g *Group) Remove(key string) error {
+	return g.RemoveContext(context.Background(), key)
+}
+
+// RemoveContext is like Remove, but gives up once ctx is done
+func (g *Group) RemoveContext(ctx context.Context, key string) error {
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+
+	owner, remote := g.pickPeer(key)
+	if remote {
+		if err := owner.Remove(ctx, &pb.Request{Group: g.name, Key: key}); err != nil {
+			return err
+		}
+	}
+	g.removeLocally(key)
+	return g.invalidate(ctx, key, owner)
+}
+
+// Purge drops all the keys of the group, on every peer if the PeerPicker
+// implements PeerLister
+func (g *Group) Purge() error {
+	return g.PurgeContext(context.Background())
+}
+
+// PurgeContext is like Purge, but gives up once ctx is done
+func (g *Group) PurgeContext(ctx context.Context) error {
+	g.purgeLocally()
+
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	var errs []error
+	for _, peer := range lister.Peers() {
+		if err := peer.Purge(ctx, &pb.Request{Group: g.name}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CacheStats returns the stats of the main or the hot cache
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	}
+	return CacheStats{}
+}
+
+func (g *Group) removeLocally(key string) {
+	g.mainCache.remove(key)
+	g.hotCache.remove(key)
+}
+
+func (g *Group) purgeLocally() {
+	g.mainCache.purge()
+	g.hotCache.purge()
+}
+
+// pickPeer returns the peer owning key, remote is false if it's this one
+func (g *Group) pickPeer(key string) (peer PeerGetter, remote bool) {
+	if g.peers == nil {
+		return nil, false
+	}
+	return g.peers.PickPeer(key)
 }
 
-func (g *Group) load(key string) (ByteView, error) {
-	view, err := g.loader.Do(key, func() (any, error) {
-		if g.peers != nil {
-			if peer, ok := g.peers.PickPeer(key); ok {
-				val, err := g.getFromPeer(peer, key)
-				if err == nil {
-					return val, nil
-				}
-				log.Println("[GeeCache] Failed to get from peer", err)
+// invalidate removes key from every peer but the owner when broadcast
+// invalidation is enabled
+func (g *Group) invalidate(ctx context.Context, key string, owner PeerGetter) error {
+	if !g.broadcast {
+		return nil
+	}
+	lister, ok := g.peers.(PeerLister)
+	if !ok {
+		return nil
+	}
+	var errs []error
+	for _, peer := range lister.Peers() {
+		if peer == owner {
+			continue
+		}
+		if err := peer.Remove(ctx, &pb.Request{Group: g.name, Key: key}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *Group) load(ctx context.Context, key string) (ByteView, error) {
+	g.stats.loads.Add(1)
+	// the load runs until every caller waiting for it is gone, so one
+	// caller giving up doesn't fail the others
+	view, err, dup := g.loader.DoContext(ctx, key, func(ctx context.Context) (any, error) {
+		if peer, ok := g.pickPeer(key); ok {
+			val, err := g.getFromPeer(ctx, peer, key)
+			if err == nil {
+				g.stats.peerLoads.Add(1)
+				return val, nil
 			}
+			g.stats.peerErrors.Add(1)
+			log.Println("[GeeCache] Failed to get from peer", err)
 		}
 
-		return g.getLocally(key)
+		val, err := g.getLocally(ctx, key)
+		if err != nil {
+			g.stats.localErrors.Add(1)
+			return nil, err
+		}
+		g.stats.localLoads.Add(1)
+		return val, nil
 	})
+	if dup {
+		g.stats.loadsDeduped.Add(1)
+	}
 
 	if err != nil {
 		return ByteView{}, err
@@ -111,31 +438,59 @@ func (g *Group) load(key string) (ByteView, error) {
 	return view.(ByteView), nil
 }
 
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
 		Group: g.name,
 		Key:   key,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	err := peer.Get(ctx, req, res)
 	if err != nil {
 		return ByteView{}, err
 	}
 
-	return ByteView{b: res.Value}, nil
+	value := ByteView{b: res.Value, e: g.expireAt(responseExpire(res))}
+	// keep a copy of about one in ten keys, so that popular ones are
+	// likely to end up in the hot cache
+	if g.hotCache.cacheBytes > 0 && rand.Intn(hotCacheRatio) == 0 {
+		g.hotCache.add(key, value)
+	}
+	return value, nil
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
-	bytes, err := g.getter.Get(key)
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
+	var (
+		bytes  []byte
+		expire time.Time
+		err    error
+	)
+	switch getter := g.getter.(type) {
+	case GetterWithExpireContext:
+		bytes, expire, err = getter.GetWithExpireContext(ctx, key)
+	case GetterWithContext:
+		bytes, err = getter.GetContext(ctx, key)
+	case GetterWithExpire:
+		bytes, expire, err = getter.GetWithExpire(key)
+	default:
+		bytes, err = g.getter.Get(key)
+	}
 	if err != nil {
 		return ByteView{}, err
 	}
 
-	val := ByteView{b: cloneBytes(bytes)}
+	val := ByteView{b: cloneBytes(bytes), e: g.expireAt(expire)}
 	g.populateCache(key, val)
 	return val, nil
 }
 
+// expireAt returns expire, or the group's default expiration if it's zero
+func (g *Group) expireAt(expire time.Time) time.Time {
+	if expire.IsZero() && g.ttl > 0 {
+		return time.Now().Add(g.ttl)
+	}
+	return expire
+}
+
 func (g *Group) populateCache(key string, val ByteView) {
 	g.mainCache.add(key, val)
 }
@@ -1,10 +1,17 @@
 package geecache
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
 	"log"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetter(t *testing.T) {
@@ -54,3 +61,393 @@ func TestGet(t *testing.T) {
 		t.Fatalf("want empty val, got %s", view)
 	}
 }
+
+func TestGetWithExpire(t *testing.T) {
+	loads := 0
+	g := NewGroup("expiring", 2<<10, GetterWithExpireFunc(
+		func(key string) ([]byte, time.Time, error) {
+			loads++
+			return []byte(key), time.Now().Add(20 * time.Millisecond), nil
+		},
+	), WithSweepInterval(5*time.Millisecond))
+	defer g.Close()
+
+	for i := 0; i < 2; i++ {
+		if view, err := g.Get("Tom"); err != nil || view.String() != "Tom" {
+			t.Fatalf("failed to get Tom: %v", err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("loaded Tom %d times before expiration, want 1", loads)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if n := g.mainCache.stats().Items; n != 0 {
+		t.Fatalf("sweeper left %d entries", n)
+	}
+	if _, err := g.Get("Tom"); err != nil || loads != 2 {
+		t.Fatalf("expired Tom not reloaded, loads: %d", loads)
+	}
+}
+
+// bothGetter implements GetterWithContext and GetterWithExpire
+type bothGetter struct{}
+
+func (bothGetter) Get(key string) ([]byte, error) { return []byte(key), nil }
+
+func (bothGetter) GetContext(ctx context.Context, key string) ([]byte, error) {
+	return []byte(key), nil
+}
+
+func (bothGetter) GetWithExpire(key string) ([]byte, time.Time, error) {
+	return []byte(key), time.Now().Add(time.Hour), nil
+}
+
+func TestGetWithExpireContext(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	g := NewGroup("expiring-contexts", 2<<10, GetterWithExpireContextFunc(
+		func(ctx context.Context, key string) ([]byte, time.Time, error) {
+			if key == "slow" {
+				<-ctx.Done()
+				return nil, time.Time{}, ctx.Err()
+			}
+			return []byte(key), expire, nil
+		},
+	))
+	if view, err := g.Get("Tom"); err != nil || !view.Expire().Equal(expire) {
+		t.Fatalf("Tom = %q expiring %v, %v, want it to expire at %v", view, view.Expire(), err, expire)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.GetContext(ctx, "slow"); err != context.DeadlineExceeded {
+		t.Fatalf("GetContext error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// GetterWithContext takes precedence, the expiration is lost
+	g = NewGroup("both", 2<<10, bothGetter{})
+	if view, err := g.Get("Tom"); err != nil || !view.Expire().IsZero() {
+		t.Fatalf("Tom = %q expiring %v, %v, want it to never expire", view, view.Expire(), err)
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	release := make(chan struct{})
+	canceled := make(chan struct{}, 1)
+	g := NewGroup("contexts", 2<<10, GetterWithContextFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			wait := release
+			if key != "Tom" {
+				wait = nil
+			}
+			select {
+			case <-wait:
+				return []byte(key), nil
+			case <-ctx.Done():
+				canceled <- struct{}{}
+				return nil, ctx.Err()
+			}
+		},
+	))
+
+	// the first caller gives up, the load goes on for the second one
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := g.GetContext(ctx, "Tom")
+		errc <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	go func() {
+		<-ctx.Done()
+		time.Sleep(5 * time.Millisecond)
+		close(release)
+	}()
+	if view, err := g.Get("Tom"); err != nil || view.String() != "Tom" {
+		t.Fatalf("Tom = %q, %v after the first caller left", view, err)
+	}
+	if err := <-errc; err != context.DeadlineExceeded {
+		t.Fatalf("GetContext error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if s := g.Stats(); s.Loads != 2 || s.LoadsDeduped != 1 || s.LocalLoads != 1 {
+		t.Fatalf("stats %+v, want 2 loads, 1 deduped", s)
+	}
+
+	// the load is canceled once nobody waits for it
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	g.GetContext(ctx, "Sam")
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("load of Sam not canceled")
+	}
+}
+
+func TestGroupTTL(t *testing.T) {
+	loads := 0
+	g := NewGroup("ttl", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		loads++
+		return []byte(key), nil
+	}), WithTTL(time.Hour))
+	defer g.Close()
+
+	view, _ := g.Get("Sam")
+	if d := time.Until(view.Expire()); d <= 59*time.Minute || d > time.Hour {
+		t.Fatalf("Sam expires in %v, want 1h", d)
+	}
+	g.Get("Sam")
+	if loads != 1 {
+		t.Fatalf("loaded Sam %d times, want 1", loads)
+	}
+	// replacing the group stops its sweeper
+	NewGroup("ttl", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return []byte(key), nil
+	}), WithTTL(time.Hour)).Close()
+	select {
+	case <-g.stop:
+	default:
+		t.Fatal("replaced group not closed")
+	}
+}
+
+// fakePeer records the keys it's asked to store or drop
+type fakePeer struct {
+	name    string
+	values  map[string]string
+	expires map[string]time.Time
+	removed []string
+	purged  int
+	gets    int
+}
+
+func (p *fakePeer) Get(_ context.Context, in *pb.Request, out *pb.Response) error {
+	p.gets++
+	out.Value = []byte(p.values[in.Key])
+	out.Expire = 0
+	if e, ok := p.expires[in.Key]; ok {
+		out.Expire = e.UnixNano()
+	}
+	return nil
+}
+
+func (p *fakePeer) Set(_ context.Context, in *pb.Request, value []byte, _ time.Time) error {
+	p.values[in.Key] = string(value)
+	return nil
+}
+
+func (p *fakePeer) Remove(_ context.Context, in *pb.Request) error {
+	p.removed = append(p.removed, in.Key)
+	return nil
+}
+
+func (p *fakePeer) Purge(_ context.Context, _ *pb.Request) error {
+	p.purged++
+	return nil
+}
+
+// fakePicker owns the keys starting with "remote", others are local
+type fakePicker struct {
+	owner, other *fakePeer
+}
+
+func (p *fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	if strings.HasPrefix(key, "remote") {
+		return p.owner, true
+	}
+	return nil, false
+}
+
+func (p *fakePicker) Peers() []PeerGetter {
+	return []PeerGetter{p.owner, p.other}
+}
+
+func TestSetRemovePurge(t *testing.T) {
+	picker := &fakePicker{
+		owner: &fakePeer{name: "owner", values: map[string]string{}},
+		other: &fakePeer{name: "other", values: map[string]string{}},
+	}
+	g := NewGroup("invalidation", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist", key)
+	}), WithBroadcastInvalidation())
+	g.RegisterPeers(picker)
+
+	if err := g.Set("local", []byte("1"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := g.Get("local"); err != nil || view.String() != "1" {
+		t.Fatalf("local = %q, %v", view, err)
+	}
+	if err := g.Set("remote", []byte("2"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if picker.owner.values["remote"] != "2" {
+		t.Fatalf("remote key not stored on the owner")
+	}
+
+	if err := g.Remove("local"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Get("local"); err == nil {
+		t.Fatalf("local still cached after Remove")
+	}
+	if err := g.Remove("remote"); err != nil {
+		t.Fatal(err)
+	}
+	// the owner of remote keys gets the broadcasts of local keys and a
+	// single Remove of its own key, the other peer gets every broadcast
+	if want := []string{"local", "local", "remote"}; !reflect.DeepEqual(picker.owner.removed, want) {
+		t.Fatalf("owner removed %v, want %v", picker.owner.removed, want)
+	}
+	if want := []string{"local", "remote", "local", "remote"}; !reflect.DeepEqual(picker.other.removed, want) {
+		t.Fatalf("other removed %v, want %v", picker.other.removed, want)
+	}
+
+	if err := g.Purge(); err != nil || picker.owner.purged != 1 || picker.other.purged != 1 {
+		t.Fatalf("Purge didn't reach every peer: %v", err)
+	}
+}
+
+func TestHotCache(t *testing.T) {
+	picker := &fakePicker{
+		owner: &fakePeer{name: "owner", values: map[string]string{"remote": "630"}},
+		other: &fakePeer{name: "other", values: map[string]string{}},
+	}
+	g := NewGroup("hot", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+	g.RegisterPeers(picker)
+
+	const n = 200
+	for i := 0; i < n; i++ {
+		if view, err := g.Get("remote"); err != nil || view.String() != "630" {
+			t.Fatalf("remote = %q, %v", view, err)
+		}
+	}
+	if picker.owner.gets == n {
+		t.Fatalf("remote never copied into the hot cache")
+	}
+	stats := g.CacheStats(HotCache)
+	if stats.Items != 1 || stats.Hits != int64(n-picker.owner.gets) {
+		t.Fatalf("hot cache stats %+v after %d peer gets", stats, picker.owner.gets)
+	}
+	if main := g.CacheStats(MainCache); main.Items != 0 {
+		t.Fatalf("remote key stored in the main cache: %+v", main)
+	}
+
+	g.Remove("remote")
+	if stats := g.CacheStats(HotCache); stats.Items != 0 {
+		t.Fatalf("hot copy survived Remove: %+v", stats)
+	}
+
+	// hot copies expire along with the owner's value
+	picker.owner.expires = map[string]time.Time{"remote": time.Now().Add(50 * time.Millisecond)}
+	for g.CacheStats(HotCache).Items == 0 {
+		g.Get("remote")
+	}
+	time.Sleep(60 * time.Millisecond)
+	gets := picker.owner.gets
+	if _, err := g.Get("remote"); err != nil || picker.owner.gets != gets+1 {
+		t.Fatalf("expired hot copy served, %d peer gets after %d", picker.owner.gets, gets)
+	}
+}
+
+func TestStats(t *testing.T) {
+	g := NewGroup("stats", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+	g.Get("Tom")
+	g.Get("Tom")
+	g.Get("unknown")
+
+	s := g.Stats()
+	want := Stats{Gets: 3, Hits: 1, Loads: 2, LocalLoads: 1, LocalErrors: 1, Bytes: 6, Items: 1}
+	want.MainCache = CacheStats{Bytes: 6, Items: 1, Gets: 3, Hits: 1}
+	want.HotCache = CacheStats{Gets: 2}
+	if !reflect.DeepEqual(s, want) {
+		t.Fatalf("stats %+v, want %+v", s, want)
+	}
+
+	w := httptest.NewRecorder()
+	NewHTTPPool("self").ServeHTTP(w, httptest.NewRequest("GET", defaultBasePath+statsPath, nil))
+	var all map[string]Stats
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil || all["stats"].Gets != 3 {
+		t.Fatalf("stats route returned %s", w.Body)
+	}
+}
+
+func TestWithPolicy(t *testing.T) {
+	policies := map[string]PolicyFactory{
+		"lru": LRU, "lfu": LFU, "2q": TwoQueue, "arc": ARC, "tinylfu": TinyLFU,
+	}
+	for name, policy := range policies {
+		loads := 0
+		g := NewGroup("policy-"+name, 20, GetterFunc(func(key string) ([]byte, error) {
+			loads++
+			return []byte("vv"), nil
+		}), WithPolicy(policy))
+
+		for i := 0; i < 10; i++ {
+			if view, err := g.Get(fmt.Sprintf("k%d", i)); err != nil || view.String() != "vv" {
+				t.Fatalf("%s: k%d = %q, %v", name, i, view, err)
+			}
+		}
+		s := g.Stats()
+		if loads != 10 || s.Bytes > 20 || s.Items != 5 || s.Evictions != 5 {
+			t.Fatalf("%s: loads %d, stats %+v", name, loads, s)
+		}
+	}
+}
+
+func TestHTTPPoolPickPeer(t *testing.T) {
+	pool := NewHTTPPool("self")
+	pool.Set("self", "a", "b")
+	// invalidate skips the owner by comparing it with the listed peers
+	for _, key := range []string{"Tom", "Jack", "Sam"} {
+		owner, ok := pool.PickPeer(key)
+		if !ok {
+			continue
+		}
+		found := false
+		for _, peer := range pool.Peers() {
+			found = found || peer == owner
+		}
+		if !found {
+			t.Fatalf("owner of %s isn't one of Peers()", key)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("HTTPPool accepted a LoadPicker")
+		}
+	}()
+	NewHTTPPoolOpts("self", &HTTPPoolOptions{
+		NewPicker: func(replicas int, fn consistenthash.Hash) consistenthash.Picker {
+			return consistenthash.NewBounded(replicas, fn, 0)
+		},
+	})
+}
+
+func TestHTTPPoolJump(t *testing.T) {
+	opts := &HTTPPoolOptions{
+		NewPicker: func(_ int, fn consistenthash.Hash) consistenthash.Picker {
+			return consistenthash.NewJump(fn)
+		},
+	}
+	a, b := NewHTTPPoolOpts("self", opts), NewHTTPPoolOpts("self", opts)
+	a.Set("x", "y", "z")
+	// y flaps on b only
+	b.Set("x", "y", "z")
+	b.Set("x", "z")
+	b.Set("z", "y", "x")
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprint(i)
+		if pa, pb := a.peers.Get(key), b.peers.Get(key); pa != pb {
+			t.Fatalf("%s owned by %s on a and %s on b", key, pa, pb)
+		}
+	}
+}
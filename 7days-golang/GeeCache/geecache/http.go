@@ -1,6 +1,10 @@
 package geecache
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"geecache/consistenthash"
 	pb "geecache/geecachepb"
@@ -9,37 +13,57 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 var _ PeerGetter = (*httpGetter)(nil)
 
+// expireHeader carries the expiration of a PUT value in RFC 3339 format
+const expireHeader = "X-Geecache-Expire"
+
 type httpGetter struct {
 	baseURL string
 }
 
-func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	u := fmt.Sprintf(
+func (h *httpGetter) url(group, key string) string {
+	return fmt.Sprintf(
 		"%v%v/%v",
 		h.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
+		url.QueryEscape(group),
+		url.QueryEscape(key),
 	)
+}
 
-	res, err := http.Get(u)
+// do sends a request and returns the response body if it succeeded
+func (h *httpGetter) do(req *http.Request) ([]byte, error) {
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned: %v", res.Status)
+		return nil, fmt.Errorf("server returned: %v", res.Status)
 	}
 
 	bytes, err := io.ReadAll(res.Body)
 	if err != nil {
-		return fmt.Errorf("reading response body: %v", err)
+		return nil, fmt.Errorf("reading response body: %v", err)
+	}
+	return bytes, nil
+}
+
+func (h *httpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url(in.GetGroup(), in.GetKey()), nil)
+	if err != nil {
+		return err
+	}
+	bytes, err := h.do(req)
+	if err != nil {
+		return err
 	}
 
 	if err = proto.Unmarshal(bytes, out); err != nil {
@@ -49,30 +73,108 @@ func (h *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 	return nil
 }
 
+func (h *httpGetter) Set(ctx context.Context, in *pb.Request, value []byte, expire time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, h.url(in.GetGroup(), in.GetKey()), bytes.NewReader(value))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if !expire.IsZero() {
+		req.Header.Set(expireHeader, expire.Format(time.RFC3339Nano))
+	}
+	_, err = h.do(req)
+	return err
+}
+
+func (h *httpGetter) Remove(ctx context.Context, in *pb.Request) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, h.url(in.GetGroup(), in.GetKey()), nil)
+	if err != nil {
+		return err
+	}
+	_, err = h.do(req)
+	return err
+}
+
+// Purge sends a DELETE without key
+func (h *httpGetter) Purge(ctx context.Context, in *pb.Request) error {
+	return h.Remove(ctx, &pb.Request{Group: in.GetGroup()})
+}
+
 const (
+	// DefaultBasePath is where peers serve each other by default
+	DefaultBasePath = defaultBasePath
 	defaultBasePath = "/geecache/"
 	defaultReplicas = 50
+	// statsPath serves the stats of all groups as JSON under basePath
+	statsPath = "_stats"
 )
 
 var (
 	_ http.Handler = (*HTTPPool)(nil)
 	_ PeerPicker   = (*HTTPPool)(nil)
+	_ PeerLister   = (*HTTPPool)(nil)
 )
 
-// HTTPPool implements PeerPicker for a pool of HTTP peers
+// HTTPPool implements PeerPicker for a pool of HTTP peers. Its base path
+// must only be reachable by the peers: PUT and DELETE let the caller
+// overwrite any key or purge a whole group.
 type HTTPPool struct {
 	self        string     // 自己的地址，主机+端口
 	basePath    string     // 节点间通讯地址的前缀
 	mu          sync.Mutex // guards peers and httpGetters
-	peers       *consistenthash.Map
+	peers       consistenthash.Picker
 	httpGetters map[string]*httpGetter
+	opts        HTTPPoolOptions
+}
+
+// HTTPPoolOptions are the options of an HTTPPool
+type HTTPPoolOptions struct {
+	// BasePath is the prefix of the paths served to the peers, it
+	// defaults to DefaultBasePath
+	BasePath string
+	// Replicas is the number of virtual nodes of a peer in the default
+	// hash ring, it defaults to 50
+	Replicas int
+	// HashFn hashes keys and peers, it defaults to crc32.ChecksumIEEE
+	HashFn consistenthash.Hash
+	// NewPicker creates the mapping of keys to peers, it defaults to a
+	// consistenthash.Map. LoadPickers aren't supported: every peer would
+	// only count its own requests, and a key moved off a busy owner
+	// would be forwarded back to it by the peer taking it.
+	NewPicker func(replicas int, fn consistenthash.Hash) consistenthash.Picker
+	// Weights of the peers, the missing ones weigh 1
+	Weights map[string]int
 }
 
 func NewHTTPPool(addr string) *HTTPPool {
-	return &HTTPPool{
+	return NewHTTPPoolOpts(addr, nil)
+}
+
+// NewHTTPPoolOpts creates an HTTPPool with options, nil means the
+// defaults
+func NewHTTPPoolOpts(addr string, o *HTTPPoolOptions) *HTTPPool {
+	p := &HTTPPool{
 		self:     addr,
 		basePath: defaultBasePath,
 	}
+	if o != nil {
+		p.opts = *o
+	}
+	if p.opts.BasePath != "" {
+		p.basePath = p.opts.BasePath
+	}
+	if p.opts.Replicas == 0 {
+		p.opts.Replicas = defaultReplicas
+	}
+	if p.opts.NewPicker == nil {
+		p.opts.NewPicker = func(replicas int, fn consistenthash.Hash) consistenthash.Picker {
+			return consistenthash.New(replicas, fn)
+		}
+	}
+	if _, ok := p.opts.NewPicker(p.opts.Replicas, p.opts.HashFn).(consistenthash.LoadPicker); ok {
+		panic("geecache: HTTPPool doesn't support LoadPickers")
+	}
+	return p
 }
 
 func (p *HTTPPool) Log(format string, v ...any) {
@@ -86,6 +188,19 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	p.Log("%s %s", req.Method, path)
 
+	if path[len(p.basePath):] == healthPath {
+		w.Write([]byte("ok"))
+		return
+	}
+
+	if path[len(p.basePath):] == statsPath {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(AllStats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
 	// /<basepath>/<groupname>/<key> required
 	parts := strings.SplitN(path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
@@ -102,33 +217,96 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	view, err := group.Get(key)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	switch req.Method {
+	case http.MethodGet:
+		// stop waiting if the requesting peer goes away, the load is only
+		// canceled once nobody waits for it
+		view, err := group.GetContext(req.Context(), key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+		body, err := proto.Marshal(newResponse(view))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Write(body)
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(body)
+	case http.MethodPut:
+		// the sender routed the key to this peer, store it here
+		var expire time.Time
+		if v := req.Header.Get(expireHeader); v != "" {
+			t, err := time.Parse(time.RFC3339Nano, v)
+			if err != nil {
+				http.Error(w, "bad "+expireHeader+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			expire = t
+		}
+		// values are bounded like the frames of a TCPPool
+		value, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxFrameSize))
+		if err != nil {
+			code := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				code = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+		if key == "" {
+			http.Error(w, "key is required", http.StatusBadRequest)
+			return
+		}
+		group.populateCache(key, ByteView{b: value, e: group.expireAt(expire)})
+	case http.MethodDelete:
+		// /<basepath>/<groupname>/ purges the whole group
+		if key == "" {
+			group.purgeLocally()
+		} else {
+			group.removeLocally(key)
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
 }
 
-// Set updates the pool's list of peers
+// Set updates the pool's list of peers, the peers joining or leaving
+// are logged since the keys they own move
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	p.peers.Add(peers...)
-	p.httpGetters = make(map[string]*httpGetter, len(peers))
-	for _, peer := range peers {
-		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+	prev := make([]string, 0, len(p.httpGetters))
+	for peer := range p.httpGetters {
+		prev = append(prev, peer)
+	}
+	joined, left := diffPeers(prev, peers)
+	if p.peers != nil && len(joined) == 0 && len(left) == 0 {
+		return
+	}
+	p.Log("peers joined %v, left %v, now %d peers", joined, left, len(peers))
+
+	// built again from the sorted peers, so that the peers map keys the
+	// same way whatever order the others joined and left in. It matters
+	// for consistenthash.Jump, where the order is the bucket numbers.
+	sorted := append([]string(nil), peers...)
+	sort.Strings(sorted)
+	p.peers = p.opts.NewPicker(p.opts.Replicas, p.opts.HashFn)
+	getters := make(map[string]*httpGetter, len(peers))
+	for _, peer := range sorted {
+		weight := 1
+		if w, ok := p.opts.Weights[peer]; ok {
+			weight = w
+		}
+		p.peers.AddWeighted(peer, weight)
+		getters[peer] = &httpGetter{baseURL: peer + p.basePath}
 	}
+	p.httpGetters = getters
 }
 
 // PickPeer picks a peer according to key
@@ -136,9 +314,26 @@ func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if p.peers == nil {
+		return nil, false
+	}
 	if peer := p.peers.Get(key); peer != "" && peer != p.self {
 		p.Log("Pick peer %s", peer)
 		return p.httpGetters[peer], true
 	}
 	return nil, false
 }
+
+// Peers returns the getters of the other peers
+func (p *HTTPPool) Peers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	peers := make([]PeerGetter, 0, len(p.httpGetters))
+	for addr, getter := range p.httpGetters {
+		if addr != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
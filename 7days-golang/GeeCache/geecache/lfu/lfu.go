@@ -0,0 +1,172 @@
+package lfu
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Value is the interface of cached values, shared with lru
+type Value = lru.Value
+
+// Cache is LFU cache, the least frequently used entry is evicted first
+// and ties are broken by recency. It is not safe for concurrent cases.
+type Cache struct {
+	maxBytes int64
+	nBytes   int64
+	cache    map[string]*list.Element
+	freqs    map[int]*list.List // frequency -> entries, most recent first
+	minFreq  int
+	// optional and executed when an entry is purged
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key    string
+	val    Value
+	expire time.Time // zero means never
+	freq   int
+}
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		cache:     make(map[string]*list.Element),
+		freqs:     make(map[int]*list.List),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Len return the number of cache entries
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes return the size of the cache entries, keys included
+func (c *Cache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Get find key's value and count the access
+func (c *Cache) Get(key string) (val Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if !kv.expire.IsZero() && time.Now().After(kv.expire) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	c.touch(ele)
+	return kv.val, true
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, val Value) {
+	c.AddWithExpire(key, val, time.Time{})
+}
+
+// AddWithExpire adds a value which expires at expire, the zero time
+// means never
+func (c *Cache) AddWithExpire(key string, val Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nBytes += int64(val.Len()) - int64(kv.val.Len())
+		kv.val = val
+		kv.expire = expire
+		c.touch(ele)
+	} else {
+		kv := &entry{key: key, val: val, expire: expire, freq: 1}
+		c.cache[key] = c.bucket(1).PushFront(kv)
+		c.minFreq = 1
+		c.nBytes += int64(len(key)) + int64(val.Len())
+	}
+
+	for c.maxBytes != 0 && c.maxBytes < c.nBytes {
+		c.RemoveLeastFrequent()
+	}
+}
+
+// RemoveLeastFrequent remove the least frequently used item
+func (c *Cache) RemoveLeastFrequent() {
+	if len(c.cache) == 0 {
+		return
+	}
+	if _, ok := c.freqs[c.minFreq]; !ok {
+		// removals may leave minFreq behind
+		c.minFreq = 0
+		for freq := range c.freqs {
+			if c.minFreq == 0 || freq < c.minFreq {
+				c.minFreq = freq
+			}
+		}
+	}
+	c.removeElement(c.freqs[c.minFreq].Back())
+}
+
+// Remove removes key, it reports whether the key was present
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes all the expired entries and returns how many
+// were removed
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, ele := range c.cache {
+		kv := ele.Value.(*entry)
+		if !kv.expire.IsZero() && now.After(kv.expire) {
+			c.removeElement(ele)
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Cache) bucket(freq int) *list.List {
+	l, ok := c.freqs[freq]
+	if !ok {
+		l = list.New()
+		c.freqs[freq] = l
+	}
+	return l
+}
+
+// touch moves the entry to the next frequency
+func (c *Cache) touch(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.unlink(ele)
+	if c.minFreq == kv.freq {
+		if _, ok := c.freqs[kv.freq]; !ok {
+			c.minFreq++
+		}
+	}
+	kv.freq++
+	c.cache[kv.key] = c.bucket(kv.freq).PushFront(kv)
+}
+
+// unlink removes the element from its frequency list
+func (c *Cache) unlink(ele *list.Element) {
+	freq := ele.Value.(*entry).freq
+	l := c.freqs[freq]
+	l.Remove(ele)
+	if l.Len() == 0 {
+		delete(c.freqs, freq)
+	}
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	c.unlink(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nBytes -= int64(len(kv.key)) + int64(kv.val.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.val)
+	}
+}
@@ -0,0 +1,78 @@
+package lfu
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (s String) Len() int {
+	return len(s)
+}
+
+func TestGet(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1234"))
+
+	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Errorf("cache hit key1=1234 failed")
+	}
+
+	if _, ok := lfu.Get("key2"); ok {
+		t.Errorf("cache miss key2 failed")
+	}
+}
+
+func TestRemoveLeastFrequent(t *testing.T) {
+	keys := make([]string, 0)
+	callback := func(key string, value Value) {
+		keys = append(keys, key)
+	}
+	// room for three entries of 4 bytes
+	lfu := New(int64(12), callback)
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	lfu.Add("k3", String("v3"))
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Get("k3")
+
+	// k2 is the least frequently used, then k3
+	lfu.Add("k4", String("v4"))
+	lfu.Add("k5", String("v5"))
+
+	if expect := []string{"k2", "k4"}; !reflect.DeepEqual(expect, keys) {
+		t.Fatalf("evicted %v, want %v", keys, expect)
+	}
+	if _, ok := lfu.Get("k1"); !ok || lfu.Len() != 3 || lfu.Bytes() != 12 {
+		t.Fatalf("len %d bytes %d, k1 present: %v", lfu.Len(), lfu.Bytes(), ok)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	evicted := 0
+	lfu := New(int64(0), func(string, Value) { evicted++ })
+	lfu.Add("key1", String("1234"))
+	lfu.Add("key1", String("123456"))
+	lfu.AddWithExpire("key2", String("12"), time.Now().Add(-time.Second))
+	if lfu.Bytes() != int64(len("key1123456key212")) {
+		t.Fatalf("bytes %d after update", lfu.Bytes())
+	}
+
+	if n := lfu.RemoveExpired(); n != 1 || lfu.Bytes() != int64(len("key1123456")) {
+		t.Fatalf("RemoveExpired removed %d, bytes %d", n, lfu.Bytes())
+	}
+	if !lfu.Remove("key1") || lfu.Bytes() != 0 || lfu.Len() != 0 || evicted != 2 {
+		t.Fatalf("bytes %d len %d evicted %d after Remove", lfu.Bytes(), lfu.Len(), evicted)
+	}
+	// removals must not break the eviction of the next entries
+	lfu.maxBytes = 8
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	lfu.Add("k3", String("v3"))
+	if lfu.Len() != 2 || lfu.Bytes() != 8 {
+		t.Fatalf("len %d bytes %d, want 2 and 8", lfu.Len(), lfu.Bytes())
+	}
+}
@@ -2,6 +2,7 @@ package lru
 
 import (
 	"container/list"
+	"time"
 )
 
 // Cache is LRU cache. It is not safe for concurrent cases.
@@ -15,8 +16,13 @@ type Cache struct {
 }
 
 type entry struct {
-	key string
-	val Value
+	key    string
+	val    Value
+	expire time.Time // zero means never
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && now.After(e.expire)
 }
 
 type Value interface {
@@ -37,11 +43,21 @@ func (c *Cache) Len() int {
 	return c.dl.Len()
 }
 
-// Get find key's value
+// Bytes return the size of the cache entries, keys included
+func (c *Cache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Get find key's value, expired entries are removed and reported as
+// missing
 func (c *Cache) Get(key string) (val Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
-		c.dl.MoveToFront(ele)
 		kv := ele.Value.(*entry)
+		if kv.expired(time.Now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		c.dl.MoveToFront(ele)
 		return kv.val, true
 	}
 
@@ -52,25 +68,61 @@ func (c *Cache) Get(key string) (val Value, ok bool) {
 func (c *Cache) RemoveOldest() {
 	ele := c.dl.Back()
 	if ele != nil {
-		c.dl.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		c.nBytes -= int64(len(kv.key)) + int64(kv.val.Len())
-		if c.OnEvicted != nil {
-			c.OnEvicted(kv.key, kv.val)
+		c.removeElement(ele)
+	}
+}
+
+// Remove removes key, it reports whether the key was present
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes all the expired entries and returns how many
+// were removed
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for ele := c.dl.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele)
+			n++
 		}
+		ele = prev
+	}
+	return n
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	c.dl.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nBytes -= int64(len(kv.key)) + int64(kv.val.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.val)
 	}
 }
 
 // Add adds a value to the cache.
 func (c *Cache) Add(key string, val Value) {
+	c.AddWithExpire(key, val, time.Time{})
+}
+
+// AddWithExpire adds a value which expires at expire, the zero time
+// means never
+func (c *Cache) AddWithExpire(key string, val Value, expire time.Time) {
 	if ele, ok := c.cache[key]; ok {
 		c.dl.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		c.nBytes += int64(val.Len()) - int64(kv.val.Len())
 		kv.val = val
+		kv.expire = expire
 	} else {
-		ele := c.dl.PushFront(&entry{key, val})
+		ele := c.dl.PushFront(&entry{key, val, expire})
 		c.cache[key] = ele
 		c.nBytes += int64(len(key)) + int64(val.Len())
 	}
@@ -3,6 +3,7 @@ package lru
 import (
 	"reflect"
 	"testing"
+	"time"
 )
 
 type String string
@@ -54,3 +55,28 @@ func TestOnEvicted(t *testing.T) {
 		t.Fatalf("Call OnEvicted failed, expect keys equals to %s", expect)
 	}
 }
+
+func TestExpire(t *testing.T) {
+	evicted := 0
+	lru := New(int64(0), func(string, Value) { evicted++ })
+	lru.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	lru.AddWithExpire("key2", String("1234"), time.Now().Add(time.Hour))
+	lru.AddWithExpire("key3", String("1234"), time.Now().Add(-time.Second))
+	lru.Add("key4", String("1234"))
+
+	if _, ok := lru.Get("key1"); ok {
+		t.Fatalf("expired key1 hit")
+	}
+	if n := lru.RemoveExpired(); n != 1 {
+		t.Fatalf("RemoveExpired removed %d entries, want 1", n)
+	}
+	if lru.Len() != 2 || evicted != 2 {
+		t.Fatalf("len %d evicted %d, want 2 and 2", lru.Len(), evicted)
+	}
+	if want := int64(2 * len("key2"+"1234")); lru.nBytes != want {
+		t.Fatalf("nBytes %d, want %d", lru.nBytes, want)
+	}
+	if !lru.Remove("key2") || lru.Remove("key2") {
+		t.Fatalf("Remove key2 failed")
+	}
+}
@@ -0,0 +1,589 @@
+package geecache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Membership tracks the peers of the cluster
+type Membership interface {
+	// Watch calls update with the current peers, then with the full list
+	// again every time it changes, until ctx is done. The pools' Set
+	// methods can be passed as update.
+	Watch(ctx context.Context, update func(peers ...string)) error
+}
+
+// StaticMembership is a fixed list of peers
+type StaticMembership []string
+
+// Watch reports the peers once and waits for ctx
+func (m StaticMembership) Watch(ctx context.Context, update func(peers ...string)) error {
+	update(m...)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+const defaultFileInterval = 5 * time.Second
+
+// FileMembership reads the peers from a file, one per line. Empty lines
+// and lines starting with # are skipped.
+type FileMembership struct {
+	Path string
+	// Interval is how often the file is checked for changes, it
+	// defaults to 5s
+	Interval time.Duration
+}
+
+func NewFileMembership(path string) *FileMembership {
+	return &FileMembership{Path: path, Interval: defaultFileInterval}
+}
+
+// Watch reads the file and reads it again whenever it's modified. It
+// fails if the first read does, later errors are logged and the last
+// good list is kept.
+func (m *FileMembership) Watch(ctx context.Context, update func(peers ...string)) error {
+	peers, mod, err := m.read()
+	if err != nil {
+		return err
+	}
+	update(peers...)
+
+	interval := m.Interval
+	if interval <= 0 {
+		interval = defaultFileInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		info, err := os.Stat(m.Path)
+		if err != nil {
+			log.Printf("[Membership] %v", err)
+			continue
+		}
+		if info.ModTime().Equal(mod) {
+			continue
+		}
+		next, nextMod, err := m.read()
+		if err != nil {
+			log.Printf("[Membership] %v", err)
+			continue
+		}
+		mod = nextMod
+		if !samePeers(peers, next) {
+			peers = next
+			update(peers...)
+		}
+	}
+}
+
+func (m *FileMembership) read() ([]string, time.Time, error) {
+	f, err := os.Open(m.Path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var peers []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			peers = append(peers, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("reading %s: %v", m.Path, err)
+	}
+	return peers, info.ModTime(), nil
+}
+
+const (
+	// GossipPath is where GossipMembership expects to be mounted on
+	// every peer
+	GossipPath = "/_geecache/gossip"
+
+	defaultGossipInterval = time.Second
+	defaultGossipTimeout  = 5 * time.Second
+	// silent peers are forgotten after forgetAfter timeouts
+	forgetAfter = 10
+	// maxGossipMembers bounds the table a peer keeps
+	maxGossipMembers = 1024
+)
+
+var _ http.Handler = (*GossipMembership)(nil)
+
+// GossipMembership discovers the peers by gossip over HTTP. Every peer
+// sets its heartbeat to its clock each round and exchanges its table
+// with a random peer. Peers whose heartbeat stops increasing for Timeout
+// are considered gone.
+//
+// The handler trusts the peers: it must only be reachable by them, not
+// exposed to clients. A peer counts as seen when its heartbeat was set,
+// not when it's received: heartbeats older than the Timeout don't bring
+// a forgotten peer back, and the ones ahead of the local clock by more
+// than half the Timeout are ignored, so the clocks must be in sync
+// within it.
+type GossipMembership struct {
+	self  string
+	seeds []string
+	// Interval is the time between two rounds, it defaults to 1s
+	Interval time.Duration
+	// Timeout is how long a silent peer is kept, it defaults to 5s
+	Timeout time.Duration
+	Client  *http.Client
+
+	mu      sync.Mutex // guards members
+	members map[string]*member
+	changed chan struct{}
+}
+
+type member struct {
+	heartbeat uint64
+	seen      time.Time // when heartbeat was set, at most when it was received
+}
+
+// NewGossipMembership creates the membership of the peer at self, which
+// joins the cluster by contacting seeds. self and seeds are base URLs
+// such as http://localhost:8001.
+func NewGossipMembership(self string, seeds ...string) *GossipMembership {
+	return &GossipMembership{
+		self:     self,
+		seeds:    seeds,
+		Interval: defaultGossipInterval,
+		Timeout:  defaultGossipTimeout,
+		Client:   http.DefaultClient,
+		members:  map[string]*member{self: {seen: time.Now()}},
+		changed:  make(chan struct{}, 1),
+	}
+}
+
+// Watch gossips every Interval and reports the live peers, self
+// included. There must be a single Watch per GossipMembership.
+func (m *GossipMembership) Watch(ctx context.Context, update func(peers ...string)) error {
+	interval, timeout := m.Interval, m.timeout()
+	if interval <= 0 {
+		interval = defaultGossipInterval
+	}
+	peers := m.alive(timeout)
+	update(peers...)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.gossip(ctx, timeout)
+		select {
+		case <-ticker.C:
+		case <-m.changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if next := m.alive(timeout); !samePeers(peers, next) {
+			peers = next
+			update(peers...)
+		}
+	}
+}
+
+func (m *GossipMembership) timeout() time.Duration {
+	if m.Timeout <= 0 {
+		return defaultGossipTimeout
+	}
+	return m.Timeout
+}
+
+// gossip bumps our heartbeat and exchanges the table with one peer
+func (m *GossipMembership) gossip(ctx context.Context, timeout time.Duration) {
+	m.mu.Lock()
+	now := time.Now()
+	// the clock keeps heartbeats increasing across restarts
+	self := m.members[m.self]
+	self.heartbeat = max64u(self.heartbeat+1, uint64(now.UnixNano()))
+	self.seen = now
+	for addr, mem := range m.members {
+		if now.Sub(mem.seen) > forgetAfter*timeout {
+			delete(m.members, addr)
+		}
+	}
+	m.mu.Unlock()
+
+	targets := m.alive(timeout)
+	for i, peer := range targets {
+		if peer == m.self {
+			targets = append(targets[:i], targets[i+1:]...)
+			break
+		}
+	}
+	if len(targets) == 0 {
+		// alone, try to join again
+		targets = m.seeds
+	}
+	if len(targets) == 0 {
+		return
+	}
+	peer := targets[rand.Intn(len(targets))]
+	if peer == m.self {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	table, err := m.exchange(ctx, peer)
+	if err != nil {
+		log.Printf("[Gossip %s] exchange with %s: %v", m.self, peer, err)
+		return
+	}
+	m.merge(table)
+}
+
+func (m *GossipMembership) exchange(ctx context.Context, peer string) (map[string]uint64, error) {
+	body, err := json.Marshal(m.table())
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, peer+GossipPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := m.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned: %v", res.Status)
+	}
+	var table map[string]uint64
+	if err := json.NewDecoder(res.Body).Decode(&table); err != nil {
+		return nil, fmt.Errorf("decoding response body: %v", err)
+	}
+	return table, nil
+}
+
+// ServeHTTP merges the table of the sender and answers with ours
+func (m *GossipMembership) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var table map[string]uint64
+	if err := json.NewDecoder(req.Body).Decode(&table); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.merge(table)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.table())
+}
+
+// table returns the heartbeats of the peers. The silent ones are kept
+// for a while so that stale gossip doesn't bring them back.
+func (m *GossipMembership) table() map[string]uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	table := make(map[string]uint64, len(m.members))
+	for addr, mem := range m.members {
+		table[addr] = mem.heartbeat
+	}
+	return table
+}
+
+func (m *GossipMembership) merge(table map[string]uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := false
+	now := time.Now()
+	// a heartbeat from the future would pin the peer's, which would stop
+	// increasing until the clock catches up
+	limit := uint64(now.Add(m.timeout() / 2).UnixNano())
+	// a stale heartbeat of a peer we forgot would bring it back
+	stale := uint64(now.Add(-m.timeout()).UnixNano())
+	for addr, heartbeat := range table {
+		if addr == m.self || heartbeat > limit {
+			continue
+		}
+		seen := time.Unix(0, int64(heartbeat))
+		if seen.After(now) {
+			seen = now
+		}
+		mem, ok := m.members[addr]
+		if !ok {
+			if len(m.members) >= maxGossipMembers || heartbeat < stale {
+				continue
+			}
+			m.members[addr] = &member{heartbeat: heartbeat, seen: seen}
+			changed = true
+		} else if heartbeat > mem.heartbeat {
+			mem.heartbeat = heartbeat
+			if seen.After(mem.seen) {
+				mem.seen = seen
+			}
+		}
+	}
+	if changed {
+		select {
+		case m.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// alive returns the sorted peers heard of within timeout
+func (m *GossipMembership) alive(timeout time.Duration) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var peers []string
+	for addr, mem := range m.members {
+		if addr == m.self || time.Since(mem.seen) < timeout {
+			peers = append(peers, addr)
+		}
+	}
+	sort.Strings(peers)
+	return peers
+}
+
+const (
+	// healthPath answers 200 under basePath while the HTTPPool is up
+	healthPath = "_health"
+
+	defaultHealthInterval  = 2 * time.Second
+	defaultHealthTimeout   = time.Second
+	defaultHealthThreshold = 3
+)
+
+// HTTPHealthCheck returns a check probing the health route of HTTPPools
+// served under basePath, a nil client means http.DefaultClient. The
+// probes are bounded by the context of the HealthChecker.
+func HTTPHealthCheck(basePath string, client *http.Client) func(ctx context.Context, addr string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return func(ctx context.Context, addr string) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr+basePath+healthPath, nil)
+		if err != nil {
+			return err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("server returned: %v", res.Status)
+		}
+		return nil
+	}
+}
+
+// TCPHealthCheck checks that a TCPPool accepts connections at addr
+func TCPHealthCheck(ctx context.Context, addr string) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// HealthChecker is a Membership which probes the peers of another one
+// and leaves out the failing ones until they recover
+type HealthChecker struct {
+	self       string
+	membership Membership
+	check      func(ctx context.Context, addr string) error
+	// Interval is the time between two probes of a peer, it defaults
+	// to 2s
+	Interval time.Duration
+	// Timeout bounds each probe, it defaults to 1s
+	Timeout time.Duration
+	// Threshold is the number of failed probes in a row after which a
+	// peer is left out, it defaults to 3
+	Threshold int
+}
+
+// NewHealthChecker checks the peers of m with check, self is never
+// probed nor left out
+func NewHealthChecker(self string, m Membership, check func(ctx context.Context, addr string) error) *HealthChecker {
+	return &HealthChecker{
+		self:       self,
+		membership: m,
+		check:      check,
+		Interval:   defaultHealthInterval,
+		Timeout:    defaultHealthTimeout,
+		Threshold:  defaultHealthThreshold,
+	}
+}
+
+// Watch reports the healthy peers of the wrapped membership
+func (h *HealthChecker) Watch(ctx context.Context, update func(peers ...string)) error {
+	interval, threshold := h.Interval, h.Threshold
+	if interval <= 0 {
+		interval = defaultHealthInterval
+	}
+	if threshold <= 0 {
+		threshold = defaultHealthThreshold
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	members := make(chan []string, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- h.membership.Watch(ctx, func(peers ...string) {
+			// only the latest list matters
+			select {
+			case <-members:
+			default:
+			}
+			members <- peers
+		})
+	}()
+
+	var (
+		peers    []string
+		known    bool // whether peers was reported yet
+		healthy  []string
+		failures = make(map[string]int)
+		ticker   = time.NewTicker(interval)
+	)
+	defer ticker.Stop()
+	for {
+		select {
+		case peers = <-members:
+			known = true
+			for addr := range failures {
+				if !containsPeer(peers, addr) {
+					delete(failures, addr)
+				}
+			}
+		case <-ticker.C:
+			for addr, ok := range h.probe(ctx, peers) {
+				switch {
+				case ok && failures[addr] >= threshold:
+					log.Printf("[Health] peer %s is back", addr)
+					fallthrough
+				case ok:
+					delete(failures, addr)
+				default:
+					failures[addr]++
+					if failures[addr] == threshold {
+						log.Printf("[Health] peer %s is down", addr)
+					}
+				}
+			}
+		case err := <-errc:
+			return err
+		}
+		if !known {
+			continue
+		}
+
+		next := make([]string, 0, len(peers))
+		for _, addr := range peers {
+			if failures[addr] < threshold {
+				next = append(next, addr)
+			}
+		}
+		if healthy == nil || !samePeers(healthy, next) {
+			healthy = next
+			update(healthy...)
+		}
+	}
+}
+
+// probe checks the peers concurrently
+func (h *HealthChecker) probe(ctx context.Context, peers []string) map[string]bool {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthTimeout
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]bool, len(peers))
+	)
+	for _, addr := range peers {
+		if addr == h.self {
+			continue
+		}
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			err := h.check(ctx, addr)
+			mu.Lock()
+			results[addr] = err == nil
+			mu.Unlock()
+		}(addr)
+	}
+	wg.Wait()
+	return results
+}
+
+// samePeers reports whether a and b hold the same peers in any order
+func samePeers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	joined, left := diffPeers(a, b)
+	return len(joined) == 0 && len(left) == 0
+}
+
+// diffPeers returns the peers of next missing from prev, and the other
+// way around
+func diffPeers(prev, next []string) (joined, left []string) {
+	for _, addr := range next {
+		if !containsPeer(prev, addr) {
+			joined = append(joined, addr)
+		}
+	}
+	for _, addr := range prev {
+		if !containsPeer(next, addr) {
+			left = append(left, addr)
+		}
+	}
+	return joined, left
+}
+
+func containsPeer(peers []string, addr string) bool {
+	for _, p := range peers {
+		if p == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func max64u(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,186 @@
+package geecache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// watch runs m.Watch in the background until ctx is done and returns
+// the latest update
+func watch(ctx context.Context, m Membership) func() []string {
+	var (
+		mu     sync.Mutex
+		latest []string
+	)
+	go m.Watch(ctx, func(peers ...string) {
+		sorted := append([]string{}, peers...)
+		sort.Strings(sorted)
+		mu.Lock()
+		latest = sorted
+		mu.Unlock()
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return latest
+	}
+}
+
+// eventually waits for the latest update to be want
+func eventually(t *testing.T, latest func() []string, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !reflect.DeepEqual(latest(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("peers = %v, want %v", latest(), want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFileMembership(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "peers")
+	if err := os.WriteFile(path, []byte("# peers\nhttp://a\n\nhttp://b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewFileMembership(path)
+	m.Interval = 5 * time.Millisecond
+	latest := watch(ctx, m)
+	eventually(t, latest, "http://a", "http://b")
+
+	os.WriteFile(path, []byte("http://a\nhttp://c\n"), 0o644)
+	// make sure the modification time moves on coarse file systems
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	eventually(t, latest, "http://a", "http://c")
+}
+
+func TestHealthChecker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var down atomic.Bool
+	h := NewHealthChecker("self", StaticMembership{"self", "a", "b"}, func(_ context.Context, addr string) error {
+		if addr == "self" {
+			t.Errorf("self probed")
+		}
+		if addr == "b" && down.Load() {
+			return errors.New("down")
+		}
+		return nil
+	})
+	h.Interval = 5 * time.Millisecond
+	h.Threshold = 2
+	latest := watch(ctx, h)
+	eventually(t, latest, "a", "b", "self")
+
+	down.Store(true)
+	eventually(t, latest, "a", "self")
+	down.Store(false)
+	eventually(t, latest, "a", "b", "self")
+
+	srv := httptest.NewServer(NewHTTPPoolOpts("self", &HTTPPoolOptions{BasePath: "/custom/"}))
+	defer srv.Close()
+	if err := HTTPHealthCheck("/custom/", nil)(ctx, srv.URL); err != nil {
+		t.Fatalf("HTTPHealthCheck = %v", err)
+	}
+}
+
+func TestGossipMembership(t *testing.T) {
+	var (
+		servers []*httptest.Server
+		cancels []context.CancelFunc
+		latest  []func() []string
+		addrs   []string
+	)
+	for i := 0; i < 3; i++ {
+		mux := http.NewServeMux()
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		cancels = append(cancels, cancel)
+		servers = append(servers, srv)
+		addrs = append(addrs, srv.URL)
+
+		// everyone joins through the first peer
+		m := NewGossipMembership(srv.URL, servers[0].URL)
+		m.Interval = 10 * time.Millisecond
+		m.Timeout = 200 * time.Millisecond
+		mux.Handle(GossipPath, m)
+		latest = append(latest, watch(ctx, m))
+	}
+	sort.Strings(addrs)
+	for _, l := range latest {
+		eventually(t, l, addrs...)
+	}
+
+	// the last peer stops and is dropped by the others
+	cancels[2]()
+	servers[2].Close()
+	gone := servers[2].URL
+	var alive []string
+	for _, addr := range addrs {
+		if addr != gone {
+			alive = append(alive, addr)
+		}
+	}
+	eventually(t, latest[0], alive...)
+	eventually(t, latest[1], alive...)
+}
+
+func TestGossipMerge(t *testing.T) {
+	m := NewGossipMembership("http://self")
+	now := uint64(time.Now().UnixNano())
+	m.merge(map[string]uint64{"http://victim": now})
+
+	// a heartbeat from the future doesn't pin the victim's
+	m.merge(map[string]uint64{"http://victim": 1<<64 - 1})
+	if hb := m.table()["http://victim"]; hb != now {
+		t.Fatalf("victim heartbeat = %d, want %d", hb, now)
+	}
+
+	// the table doesn't grow without bounds
+	table := make(map[string]uint64)
+	for i := 0; i < 2*maxGossipMembers; i++ {
+		table[fmt.Sprintf("http://peer%d", i)] = now
+	}
+	m.merge(table)
+	if n := len(m.table()); n > maxGossipMembers {
+		t.Fatalf("%d members kept, want at most %d", n, maxGossipMembers)
+	}
+
+	// silent peers are forgotten eventually
+	m.mu.Lock()
+	for _, mem := range m.members {
+		mem.seen = mem.seen.Add(-forgetAfter * 2 * m.Timeout)
+	}
+	m.mu.Unlock()
+	m.gossip(context.Background(), m.Timeout)
+	if table := m.table(); len(table) != 1 {
+		t.Fatalf("%d members left, want only self", len(table))
+	}
+
+	// a node which still holds the stale heartbeat of a forgotten peer
+	// doesn't bring it back
+	m.merge(map[string]uint64{"http://victim": uint64(time.Now().Add(-forgetAfter * m.Timeout).UnixNano())})
+	if _, ok := m.table()["http://victim"]; ok {
+		t.Fatal("forgotten peer re-added by stale gossip")
+	}
+	// nor does a heartbeat which is received late make a peer alive
+	m.merge(map[string]uint64{"http://late": uint64(time.Now().Add(-m.Timeout / 2).UnixNano())})
+	if alive := m.alive(m.Timeout / 4); len(alive) != 1 {
+		t.Fatalf("alive = %v, want only self", alive)
+	}
+}
@@ -1,6 +1,10 @@
 package geecache
 
-import pb "geecache/geecachepb"
+import (
+	"context"
+	pb "geecache/geecachepb"
+	"time"
+)
 
 // PeerPicker is the interface that must be implemented to locate
 // the peer that owns a specific key
@@ -8,7 +12,38 @@ type PeerPicker interface {
 	PickPeer(key string) (PeerGetter, bool)
 }
 
-// PeerGetter is the interface that must be implemented by a peer
+// PeerGetter is the interface that must be implemented by a peer, the
+// calls give up once ctx is done
 type PeerGetter interface {
-	Get(in *pb.Request, out *pb.Response) error
+	Get(ctx context.Context, in *pb.Request, out *pb.Response) error
+	// Set stores value on the peer, the zero expire means the peer's TTL
+	Set(ctx context.Context, in *pb.Request, value []byte, expire time.Time) error
+	// Remove drops in.Key from the peer's cache
+	Remove(ctx context.Context, in *pb.Request) error
+	// Purge drops all the keys of in.Group from the peer's cache
+	Purge(ctx context.Context, in *pb.Request) error
+}
+
+// PeerLister is implemented by PeerPickers which can enumerate the other
+// peers, it's needed to purge or invalidate keys cluster-wide
+type PeerLister interface {
+	Peers() []PeerGetter
+}
+
+// newResponse returns the response to a Get of view, its expiration goes
+// along so that peers don't keep copies of the value for longer
+func newResponse(view ByteView) *pb.Response {
+	res := &pb.Response{Value: view.ByteSlice()}
+	if e := view.Expire(); !e.IsZero() {
+		res.Expire = e.UnixNano()
+	}
+	return res
+}
+
+// responseExpire returns the expiration of res, the zero time means never
+func responseExpire(res *pb.Response) time.Time {
+	if ns := res.GetExpire(); ns != 0 {
+		return time.Unix(0, ns)
+	}
+	return time.Time{}
 }
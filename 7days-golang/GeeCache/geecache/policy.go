@@ -0,0 +1,60 @@
+package geecache
+
+import (
+	"geecache/arc"
+	"geecache/lfu"
+	"geecache/lru"
+	"geecache/tinylfu"
+	"geecache/twoq"
+	"time"
+)
+
+// EvictionPolicy stores the entries of a cache and decides which ones to
+// evict once maxBytes is exceeded. Implementations don't need to be safe
+// for concurrent use, and call onEvicted for every entry they drop.
+type EvictionPolicy interface {
+	Get(key string) (lru.Value, bool)
+	AddWithExpire(key string, val lru.Value, expire time.Time)
+	Remove(key string) bool
+	RemoveExpired() int
+	Len() int
+	Bytes() int64
+}
+
+// PolicyFactory creates an EvictionPolicy holding up to maxBytes
+type PolicyFactory func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy
+
+var (
+	_ EvictionPolicy = (*lru.Cache)(nil)
+	_ EvictionPolicy = (*lfu.Cache)(nil)
+	_ EvictionPolicy = (*twoq.Cache)(nil)
+	_ EvictionPolicy = (*arc.Cache)(nil)
+	_ EvictionPolicy = (*tinylfu.Cache)(nil)
+)
+
+// The built-in eviction policies
+var (
+	LRU PolicyFactory = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return lru.New(maxBytes, onEvicted)
+	}
+	LFU PolicyFactory = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return lfu.New(maxBytes, onEvicted)
+	}
+	TwoQueue PolicyFactory = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return twoq.New(maxBytes, onEvicted)
+	}
+	ARC PolicyFactory = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return arc.New(maxBytes, onEvicted)
+	}
+	TinyLFU PolicyFactory = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return tinylfu.New(maxBytes, onEvicted)
+	}
+)
+
+// WithPolicy sets the eviction policy of the main and hot caches, it
+// defaults to LRU
+func WithPolicy(policy PolicyFactory) GroupOption {
+	return func(g *Group) {
+		g.policy = policy
+	}
+}
@@ -1,11 +1,19 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
 
 type call struct {
-	wg  sync.WaitGroup
-	val any
-	err error
+	done    chan struct{} // 调用结束时关闭
+	val     any
+	err     error
+	panic   *PanicError // fn panic 时不为 nil
+	waiters int         // 仍在等待的调用方数量
+	cancel  context.CancelFunc
 }
 
 type Group struct {
@@ -13,33 +21,86 @@ type Group struct {
 	m  map[string]*call
 }
 
+// PanicError 是 fn panic 时等待者收到的值，带有 fn 所在 goroutine 的栈
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.Value, p.Stack)
+}
+
 func (g *Group) Do(key string, fn func() (any, error)) (any, error) {
+	v, err, _ := g.DoContext(context.Background(), key, func(context.Context) (any, error) {
+		return fn()
+	})
+	return v, err
+}
+
+// DoContext 与 Do 相同，但 ctx 取消时调用方不再等待，直接返回 ctx.Err()。
+// fn 在独立的 ctx 下执行，只有所有等待者都离开时才会被取消。
+// dup 表示调用方加入了已存在的调用。fn panic 时每个等待者都会重新 panic。
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) (v any, err error, dup bool) {
 	g.mu.Lock()
 	if g.m == nil {
 		g.m = make(map[string]*call) // 延迟加载
 	}
 	// 调用已存在
-	if c, ok := g.m[key]; ok {
-		g.mu.Unlock()
-		// 等待调用结束
-		c.wg.Wait()
-		// 直接返回
-		return c.val, c.err
+	c, dup := g.m[key]
+	if !dup {
+		// 调用不存在，创建新调用
+		fctx, cancel := context.WithCancel(context.Background())
+		c = &call{done: make(chan struct{}), cancel: cancel}
+		g.m[key] = c
+		go g.run(fctx, key, c, fn)
 	}
-	// 调用不存在，创建新调用
-	c := new(call)
-	c.wg.Add(1)
-	g.m[key] = c
+	c.waiters++
 	g.mu.Unlock()
 
-	// 发起调用
-	c.val, c.err = fn()
-	c.wg.Done()
+	// 等待调用结束或 ctx 取消
+	select {
+	case <-c.done:
+		if c.panic != nil {
+			panic(c.panic)
+		}
+		return c.val, c.err, dup
+	case <-ctx.Done():
+		g.leave(key, c)
+		return nil, ctx.Err(), dup
+	}
+}
 
-	// 调用结束，删除调用
+// leave 在调用方放弃等待时调用，最后一个等待者离开时取消 fn
+func (g *Group) leave(key string, c *call) {
 	g.mu.Lock()
-	delete(g.m, key)
-	g.mu.Unlock()
+	defer g.mu.Unlock()
+	c.waiters--
+	if c.waiters > 0 {
+		return
+	}
+	c.cancel()
+	// 之后的调用方重新发起调用，不再加入已取消的调用
+	if g.m[key] == c {
+		delete(g.m, key)
+	}
+}
+
+func (g *Group) run(ctx context.Context, key string, c *call, fn func(context.Context) (any, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.panic = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+		// 调用结束，删除调用
+		g.mu.Lock()
+		if g.m[key] == c {
+			delete(g.m, key)
+		}
+		g.mu.Unlock()
+		c.cancel()
+		close(c.done)
+	}()
 
-	return c.val, c.err
+	// 发起调用
+	c.val, c.err = fn(ctx)
 }
@@ -0,0 +1,100 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.Do("key", func() (any, error) {
+				calls.Add(1)
+				<-release
+				return "bar", nil
+			})
+			if v != "bar" || err != nil {
+				t.Errorf("Do = %v, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Fatalf("fn called %d times, want 1", n)
+	}
+}
+
+func TestDoContextCancel(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (any, error) {
+		select {
+		case <-release:
+			return "bar", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// the first caller leaves, the call goes on for the second one
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	go func() {
+		if _, err, _ := g.DoContext(ctx, "key", fn); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("DoContext error = %v, want deadline exceeded", err)
+		}
+	}()
+	time.Sleep(5 * time.Millisecond)
+	go func() {
+		<-ctx.Done()
+		time.Sleep(5 * time.Millisecond)
+		close(release)
+	}()
+	v, err, dup := g.DoContext(context.Background(), "key", fn)
+	if v != "bar" || err != nil || !dup {
+		t.Fatalf("DoContext = %v, %v, %v", v, err, dup)
+	}
+}
+
+func TestDoContextLastWaiter(t *testing.T) {
+	var g Group
+	canceled := make(chan struct{})
+	fn := func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		close(canceled)
+		return nil, ctx.Err()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	g.DoContext(ctx, "key", fn)
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("fn not canceled when its only waiter left")
+	}
+}
+
+func TestDoPanic(t *testing.T) {
+	var g Group
+	defer func() {
+		if p, ok := recover().(*PanicError); !ok || p.Value != "boom" {
+			t.Fatalf("recovered %v, want the PanicError of fn", p)
+		}
+	}()
+	g.Do("key", func() (any, error) {
+		panic("boom")
+	})
+}
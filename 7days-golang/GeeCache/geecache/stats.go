@@ -0,0 +1,66 @@
+package geecache
+
+import "sync/atomic"
+
+// groupStats are the counters of a Group, updated atomically
+type groupStats struct {
+	gets         atomic.Int64 // any Get request, including from peers
+	hits         atomic.Int64 // either cache was good
+	peerLoads    atomic.Int64 // remote load or remote cache hit
+	peerErrors   atomic.Int64
+	loads        atomic.Int64 // gets - hits
+	loadsDeduped atomic.Int64 // loads which waited for another one
+	localLoads   atomic.Int64 // total good local loads
+	localErrors  atomic.Int64 // total bad local loads
+}
+
+// Stats is a snapshot of the statistics of a Group
+type Stats struct {
+	Gets         int64 `json:"gets"`
+	Hits         int64 `json:"hits"`
+	PeerLoads    int64 `json:"peer_loads"`
+	PeerErrors   int64 `json:"peer_errors"`
+	Loads        int64 `json:"loads"`
+	LoadsDeduped int64 `json:"loads_deduped"`
+	LocalLoads   int64 `json:"local_loads"`
+	LocalErrors  int64 `json:"local_errors"`
+	// Evictions, Bytes and Items sum up both caches
+	Evictions int64 `json:"evictions"`
+	Bytes     int64 `json:"bytes"`
+	Items     int64 `json:"items"`
+
+	MainCache CacheStats `json:"main_cache"`
+	HotCache  CacheStats `json:"hot_cache"`
+}
+
+// Stats returns a snapshot of the group statistics
+func (g *Group) Stats() Stats {
+	s := Stats{
+		Gets:         g.stats.gets.Load(),
+		Hits:         g.stats.hits.Load(),
+		PeerLoads:    g.stats.peerLoads.Load(),
+		PeerErrors:   g.stats.peerErrors.Load(),
+		Loads:        g.stats.loads.Load(),
+		LoadsDeduped: g.stats.loadsDeduped.Load(),
+		LocalLoads:   g.stats.localLoads.Load(),
+		LocalErrors:  g.stats.localErrors.Load(),
+		MainCache:    g.mainCache.stats(),
+		HotCache:     g.hotCache.stats(),
+	}
+	s.Evictions = s.MainCache.Evictions + s.HotCache.Evictions
+	s.Bytes = s.MainCache.Bytes + s.HotCache.Bytes
+	s.Items = s.MainCache.Items + s.HotCache.Items
+	return s
+}
+
+// AllStats returns the stats of every group by name
+func AllStats() map[string]Stats {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	stats := make(map[string]Stats, len(groups))
+	for name, g := range groups {
+		stats[name] = g.Stats()
+	}
+	return stats
+}
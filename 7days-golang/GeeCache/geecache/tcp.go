@@ -0,0 +1,536 @@
+package geecache
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"geecache/consistenthash"
+	pb "geecache/geecachepb"
+	"github.com/golang/protobuf/proto"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Peers talk over persistent TCP connections carrying frames of
+//
+//	[uint32 length][uint64 id][op byte][payload]
+//
+// where length counts the id, op and payload. Requests are answered with
+// the same id, so many of them can be in flight on one connection.
+const (
+	opGet byte = iota + 1
+	opSet
+	opRemove
+	opPurge
+
+	opOK    byte = 0x80 // payload is the result
+	opError byte = 0x81 // payload is the error message
+)
+
+const (
+	frameHeaderSize     = 8 + 1
+	maxFrameSize        = 64 << 20
+	maxRequestsPerConn  = 128 // served concurrently on one connection
+	defaultTCPTimeout   = 5 * time.Second
+	defaultConnsPerPeer = 2
+)
+
+type frame struct {
+	id      uint64
+	op      byte
+	payload []byte
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	buf := make([]byte, 4+frameHeaderSize+len(f.payload))
+	binary.BigEndian.PutUint32(buf, uint32(frameHeaderSize+len(f.payload)))
+	binary.BigEndian.PutUint64(buf[4:], f.id)
+	buf[12] = f.op
+	copy(buf[13:], f.payload)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readFrame(r io.Reader) (frame, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return frame{}, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < frameHeaderSize || n > maxFrameSize {
+		return frame{}, fmt.Errorf("invalid frame size %d", n)
+	}
+	// grow with the bytes actually received, not the announced size
+	buf, err := io.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil {
+		return frame{}, err
+	}
+	if len(buf) < int(n) {
+		return frame{}, io.ErrUnexpectedEOF
+	}
+	return frame{
+		id:      binary.BigEndian.Uint64(buf),
+		op:      buf[8],
+		payload: buf[frameHeaderSize:],
+	}, nil
+}
+
+// encodeSet lays out a Set payload as
+// [uvarint request length][request][int64 expire in unix ns, 0 is never][value]
+func encodeSet(in *pb.Request, value []byte, expire time.Time) ([]byte, error) {
+	req, err := proto.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	buf := binary.AppendUvarint(nil, uint64(len(req)))
+	buf = append(buf, req...)
+	var ns int64
+	if !expire.IsZero() {
+		ns = expire.UnixNano()
+	}
+	buf = binary.BigEndian.AppendUint64(buf, uint64(ns))
+	return append(buf, value...), nil
+}
+
+func decodeSet(payload []byte) (*pb.Request, []byte, time.Time, error) {
+	n, size := binary.Uvarint(payload)
+	if size <= 0 || uint64(len(payload)-size) < n+8 {
+		return nil, nil, time.Time{}, errors.New("malformed set payload")
+	}
+	payload = payload[size:]
+	in := &pb.Request{}
+	if err := proto.Unmarshal(payload[:n], in); err != nil {
+		return nil, nil, time.Time{}, err
+	}
+	var expire time.Time
+	if ns := int64(binary.BigEndian.Uint64(payload[n:])); ns != 0 {
+		expire = time.Unix(0, ns)
+	}
+	return in, payload[n+8:], expire, nil
+}
+
+// tcpConn is a client connection multiplexing concurrent requests
+type tcpConn struct {
+	conn    net.Conn
+	wmu     sync.Mutex // serializes writes
+	mu      sync.Mutex // guards pending and err
+	pending map[uint64]chan frame
+	err     error // set once the connection is broken
+}
+
+func dialTCPConn(ctx context.Context, addr string, timeout time.Duration) (*tcpConn, error) {
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &tcpConn{conn: conn, pending: make(map[uint64]chan frame)}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *tcpConn) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		c.mu.Lock()
+		ch := c.pending[f.id]
+		delete(c.pending, f.id)
+		c.mu.Unlock()
+		if ch != nil {
+			ch <- f
+		}
+	}
+}
+
+// fail closes the connection and wakes up the pending calls
+func (c *tcpConn) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	c.conn.Close()
+}
+
+func (c *tcpConn) broken() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// call sends req and waits for the response until timeout elapses or
+// ctx is done
+func (c *tcpConn) call(ctx context.Context, req frame, timeout time.Duration) (frame, error) {
+	ch := make(chan frame, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return frame{}, c.err
+	}
+	c.pending[req.id] = ch
+	c.mu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.wmu.Lock()
+	c.conn.SetWriteDeadline(deadline)
+	err := writeFrame(c.conn, req)
+	c.wmu.Unlock()
+	if err != nil {
+		// a partial frame breaks the stream
+		c.fail(err)
+		return frame{}, err
+	}
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case res, ok := <-ch:
+		if !ok {
+			return frame{}, c.broken()
+		}
+		return res, nil
+	case <-timer.C:
+		err = fmt.Errorf("request to %s timed out after %v", c.conn.RemoteAddr(), timeout)
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	// a late response is dropped by the read loop
+	c.mu.Lock()
+	delete(c.pending, req.id)
+	c.mu.Unlock()
+	return frame{}, err
+}
+
+var _ PeerGetter = (*tcpGetter)(nil)
+
+// tcpGetter keeps a few connections to a peer and spreads the requests
+// over them
+type tcpGetter struct {
+	addr    string
+	timeout time.Duration
+	ids     atomic.Uint64
+	mu      sync.Mutex // guards conns, next and closed
+	conns   []*tcpConn
+	next    int
+	closed  bool
+}
+
+// conn returns the next connection, dialing it again if it's broken.
+// The dial happens without the lock, so that an unreachable peer only
+// holds the callers of this connection.
+func (g *tcpGetter) conn(ctx context.Context) (*tcpConn, error) {
+	g.mu.Lock()
+	i := g.next % len(g.conns)
+	g.next++
+	if c := g.conns[i]; c != nil && c.broken() == nil {
+		g.mu.Unlock()
+		return c, nil
+	}
+	g.mu.Unlock()
+
+	c, err := dialTCPConn(ctx, g.addr, g.timeout)
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		c.fail(net.ErrClosed)
+		return nil, net.ErrClosed
+	}
+	if cur := g.conns[i]; cur != nil && cur != c && cur.broken() == nil {
+		// another caller redialed first
+		c.fail(net.ErrClosed)
+		return cur, nil
+	}
+	g.conns[i] = c
+	return c, nil
+}
+
+func (g *tcpGetter) do(ctx context.Context, op byte, payload []byte) ([]byte, error) {
+	c, err := g.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.call(ctx, frame{id: g.ids.Add(1), op: op, payload: payload}, g.timeout)
+	if err != nil {
+		return nil, err
+	}
+	if res.op != opOK {
+		return nil, fmt.Errorf("server returned: %s", res.payload)
+	}
+	return res.payload, nil
+}
+
+func (g *tcpGetter) close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	for _, c := range g.conns {
+		if c != nil {
+			c.fail(net.ErrClosed)
+		}
+	}
+}
+
+func (g *tcpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	req, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	res, err := g.do(ctx, opGet, req)
+	if err != nil {
+		return err
+	}
+	if err = proto.Unmarshal(res, out); err != nil {
+		return fmt.Errorf("decoding response: %v", err)
+	}
+	return nil
+}
+
+func (g *tcpGetter) Set(ctx context.Context, in *pb.Request, value []byte, expire time.Time) error {
+	req, err := encodeSet(in, value, expire)
+	if err != nil {
+		return err
+	}
+	_, err = g.do(ctx, opSet, req)
+	return err
+}
+
+func (g *tcpGetter) Remove(ctx context.Context, in *pb.Request) error {
+	req, err := proto.Marshal(in)
+	if err != nil {
+		return err
+	}
+	_, err = g.do(ctx, opRemove, req)
+	return err
+}
+
+func (g *tcpGetter) Purge(ctx context.Context, in *pb.Request) error {
+	req, err := proto.Marshal(&pb.Request{Group: in.GetGroup()})
+	if err != nil {
+		return err
+	}
+	_, err = g.do(ctx, opPurge, req)
+	return err
+}
+
+var (
+	_ PeerPicker = (*TCPPool)(nil)
+	_ PeerLister = (*TCPPool)(nil)
+)
+
+// TCPPool implements PeerPicker for a pool of peers talking the binary
+// TCP protocol, it's an alternative to HTTPPool
+type TCPPool struct {
+	self string // host:port this peer listens on
+	// Timeout bounds dialing, writing and waiting for each request,
+	// it defaults to 5s
+	Timeout time.Duration
+	// ConnsPerPeer is the number of connections kept to each peer,
+	// it defaults to 2
+	ConnsPerPeer int
+	mu           sync.Mutex // guards peers and tcpGetters
+	peers        *consistenthash.Map
+	tcpGetters   map[string]*tcpGetter
+}
+
+func NewTCPPool(addr string) *TCPPool {
+	return &TCPPool{
+		self:         addr,
+		Timeout:      defaultTCPTimeout,
+		ConnsPerPeer: defaultConnsPerPeer,
+	}
+}
+
+func (p *TCPPool) Log(format string, v ...any) {
+	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+}
+
+// ListenAndServe listens on the pool's own address and serves peers
+func (p *TCPPool) ListenAndServe() error {
+	l, err := net.Listen("tcp", p.self)
+	if err != nil {
+		return err
+	}
+	return p.Serve(l)
+}
+
+// Serve accepts peer connections on l
+func (p *TCPPool) Serve(l net.Listener) error {
+	defer l.Close()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go p.serveConn(conn)
+	}
+}
+
+func (p *TCPPool) serveConn(conn net.Conn) {
+	defer conn.Close()
+	var wmu sync.Mutex
+	// reading stops while the connection has too many requests going on
+	sem := make(chan struct{}, maxRequestsPerConn)
+	r := bufio.NewReader(conn)
+	for {
+		req, err := readFrame(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				p.Log("reading from %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		// answer concurrently, a slow load must not hold the others
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem }()
+			res := p.handle(req)
+			wmu.Lock()
+			defer wmu.Unlock()
+			conn.SetWriteDeadline(time.Now().Add(p.Timeout))
+			if err := writeFrame(conn, res); err != nil {
+				p.Log("writing to %s: %v", conn.RemoteAddr(), err)
+				conn.Close()
+			}
+		}()
+	}
+}
+
+func (p *TCPPool) handle(req frame) frame {
+	res, err := p.apply(req)
+	if err != nil {
+		return frame{id: req.id, op: opError, payload: []byte(err.Error())}
+	}
+	return frame{id: req.id, op: opOK, payload: res}
+}
+
+func (p *TCPPool) apply(req frame) ([]byte, error) {
+	var (
+		in     = &pb.Request{}
+		value  []byte
+		expire time.Time
+		err    error
+	)
+	if req.op == opSet {
+		in, value, expire, err = decodeSet(req.payload)
+	} else {
+		err = proto.Unmarshal(req.payload, in)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad request: %v", err)
+	}
+
+	group := GetGroup(in.GetGroup())
+	if group == nil {
+		return nil, fmt.Errorf("no such group: %s", in.GetGroup())
+	}
+
+	switch req.op {
+	case opGet:
+		// the protocol has no cancellation, bound the load instead
+		ctx, cancel := context.WithTimeout(context.Background(), p.Timeout)
+		defer cancel()
+		view, err := group.GetContext(ctx, in.GetKey())
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(newResponse(view))
+	case opSet:
+		if in.GetKey() == "" {
+			return nil, fmt.Errorf("key is required")
+		}
+		group.populateCache(in.GetKey(), ByteView{b: value, e: group.expireAt(expire)})
+	case opRemove:
+		group.removeLocally(in.GetKey())
+	case opPurge:
+		group.purgeLocally()
+	default:
+		return nil, fmt.Errorf("unknown op %#x", req.op)
+	}
+	return nil, nil
+}
+
+// Set updates the pool's list of peers, connections to the peers which
+// are gone are closed. The peers joining or leaving are logged since the
+// keys they own move.
+func (p *TCPPool) Set(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	prev := make([]string, 0, len(p.tcpGetters))
+	for peer := range p.tcpGetters {
+		prev = append(prev, peer)
+	}
+	joined, left := diffPeers(prev, peers)
+	if p.peers != nil && len(joined) == 0 && len(left) == 0 {
+		return
+	}
+	p.Log("peers joined %v, left %v, now %d peers", joined, left, len(peers))
+
+	// only the keys of the peers joining or leaving move
+	if p.peers == nil {
+		p.peers = consistenthash.New(defaultReplicas, nil)
+		p.tcpGetters = make(map[string]*tcpGetter, len(peers))
+	}
+	p.peers.Remove(left...)
+	for _, peer := range left {
+		p.tcpGetters[peer].close()
+		delete(p.tcpGetters, peer)
+	}
+	p.peers.Add(joined...)
+	n := p.ConnsPerPeer
+	if n < 1 {
+		n = 1
+	}
+	for _, peer := range joined {
+		p.tcpGetters[peer] = &tcpGetter{addr: peer, timeout: p.Timeout, conns: make([]*tcpConn, n)}
+	}
+}
+
+// PickPeer picks a peer according to key
+func (p *TCPPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.peers == nil {
+		return nil, false
+	}
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		return p.tcpGetters[peer], true
+	}
+	return nil, false
+}
+
+// Peers returns the getters of the other peers
+func (p *TCPPool) Peers() []PeerGetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	peers := make([]PeerGetter, 0, len(p.tcpGetters))
+	for addr, getter := range p.tcpGetters {
+		if addr != p.self {
+			peers = append(peers, getter)
+		}
+	}
+	return peers
+}
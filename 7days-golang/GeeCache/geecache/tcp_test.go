@@ -0,0 +1,142 @@
+package geecache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	pb "geecache/geecachepb"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFrame(t *testing.T) {
+	var buf bytes.Buffer
+	want := frame{id: 42, op: opGet, payload: []byte("payload")}
+	if err := writeFrame(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readFrame(&buf)
+	if err != nil || got.id != want.id || got.op != want.op || !bytes.Equal(got.payload, want.payload) {
+		t.Fatalf("readFrame = %+v, %v, want %+v", got, err, want)
+	}
+
+	// a frame announcing more than it carries fails without allocating
+	// the announced size
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = readFrame(bytes.NewReader([]byte{0x03, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 1, opGet}))
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("readFrame of a short frame = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Fatalf("readFrame allocated %d bytes for a short frame", n)
+	}
+
+	expire := time.Unix(0, time.Now().UnixNano())
+	payload, _ := encodeSet(&pb.Request{Group: "g", Key: "k"}, []byte("v"), expire)
+	in, value, gotExpire, err := decodeSet(payload)
+	if err != nil || in.Key != "k" || string(value) != "v" || !gotExpire.Equal(expire) {
+		t.Fatalf("decodeSet = %v, %q, %v, %v", in, value, gotExpire, err)
+	}
+}
+
+// startTCPPool serves a TCPPool on a random local port
+func startTCPPool(t *testing.T) (*TCPPool, net.Listener) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := NewTCPPool(l.Addr().String())
+	go pool.Serve(l)
+	t.Cleanup(func() { l.Close() })
+	return pool, l
+}
+
+func TestTCPGetter(t *testing.T) {
+	var mu sync.Mutex
+	loads := 0
+	g := NewGroup("tcp", 2<<10, GetterFunc(func(key string) ([]byte, error) {
+		if key == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		mu.Lock()
+		loads++
+		mu.Unlock()
+		if v, ok := db[key]; ok {
+			return []byte(v), nil
+		}
+		return nil, fmt.Errorf("%s not exist", key)
+	}))
+	_, l := startTCPPool(t)
+
+	client := NewTCPPool("client")
+	client.Timeout = 100 * time.Millisecond
+	// requests may come before the first Set
+	if peer, ok := client.PickPeer("Tom"); ok || peer != nil {
+		t.Fatalf("PickPeer before Set = %v, %v", peer, ok)
+	}
+	client.Set(l.Addr().String())
+	peer, ok := client.PickPeer("Tom")
+	if !ok {
+		t.Fatal("no peer picked")
+	}
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for k, v := range db {
+				out := &pb.Response{}
+				if err := peer.Get(ctx, &pb.Request{Group: "tcp", Key: k}, out); err != nil || string(out.Value) != v {
+					t.Errorf("Get(%s) = %q, %v", k, out.Value, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	err := peer.Get(ctx, &pb.Request{Group: "tcp", Key: "unknown"}, &pb.Response{})
+	if err == nil || !strings.Contains(err.Error(), "unknown not exist") {
+		t.Fatalf("Get(unknown) error = %v", err)
+	}
+	err = peer.Get(ctx, &pb.Request{Group: "tcp", Key: "slow"}, &pb.Response{})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Get(slow) error = %v, want a timeout", err)
+	}
+
+	if err := peer.Set(ctx, &pb.Request{Group: "tcp", Key: "Ann"}, []byte("700"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := g.Get("Ann"); err != nil || view.String() != "700" {
+		t.Fatalf("Ann = %q, %v after Set", view, err)
+	}
+	if err := peer.Remove(ctx, &pb.Request{Group: "tcp", Key: "Ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := peer.Purge(ctx, &pb.Request{Group: "tcp"}); err != nil {
+		t.Fatal(err)
+	}
+	if s := g.Stats(); s.Items != 0 {
+		t.Fatalf("%d items left after Purge", s.Items)
+	}
+
+	// broken connections are dialed again
+	for _, c := range peer.(*tcpGetter).conns {
+		if c != nil {
+			c.conn.Close()
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	out := &pb.Response{}
+	if err := peer.Get(ctx, &pb.Request{Group: "tcp", Key: "Tom"}, out); err != nil || string(out.Value) != "630" {
+		t.Fatalf("Get(Tom) = %q, %v after reconnecting", out.Value, err)
+	}
+}
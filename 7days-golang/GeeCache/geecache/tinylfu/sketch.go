@@ -0,0 +1,85 @@
+package tinylfu
+
+import "hash/fnv"
+
+// sketchDepth is the number of rows of the count-min sketch
+const sketchDepth = 4
+
+// sketch is a count-min sketch of 4-bit counters estimating how often
+// keys were seen. Counters are halved every sample additions, so that
+// old popularity fades.
+type sketch struct {
+	rows      [sketchDepth][]byte // two counters per byte
+	mask      uint64
+	additions int
+	sample    int
+}
+
+// newSketch creates a sketch with width counters per row, rounded up to
+// a power of two
+func newSketch(width int) *sketch {
+	n := 16
+	for n < width {
+		n <<= 1
+	}
+	s := &sketch{mask: uint64(n - 1), sample: 10 * n}
+	for i := range s.rows {
+		s.rows[i] = make([]byte, n/2)
+	}
+	return s
+}
+
+// indexes returns the counter of key in each row, derived from two
+// halves of a 64-bit hash
+func (s *sketch) indexes(key string) [sketchDepth]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum, sum>>32|sum<<32
+	var idx [sketchDepth]uint64
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return idx
+}
+
+func (s *sketch) counter(row int, i uint64) byte {
+	return (s.rows[row][i/2] >> ((i & 1) * 4)) & 0x0f
+}
+
+// increment counts one more occurrence of key
+func (s *sketch) increment(key string) {
+	idx := s.indexes(key)
+	for row, i := range idx {
+		if s.counter(row, i) < 15 {
+			s.rows[row][i/2] += 1 << ((i & 1) * 4)
+		}
+	}
+	s.additions++
+	if s.additions >= s.sample {
+		s.reset()
+	}
+}
+
+// estimate returns the smallest counter of key, an upper bound of how
+// often it was seen
+func (s *sketch) estimate(key string) byte {
+	idx := s.indexes(key)
+	min := byte(15)
+	for row, i := range idx {
+		if c := s.counter(row, i); c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// reset halves every counter
+func (s *sketch) reset() {
+	for _, row := range s.rows {
+		for i := range row {
+			row[i] = (row[i] >> 1) & 0x77
+		}
+	}
+	s.additions /= 2
+}
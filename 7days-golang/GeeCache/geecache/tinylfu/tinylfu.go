@@ -0,0 +1,211 @@
+package tinylfu
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Value is the interface of cached values, shared with lru
+type Value = lru.Value
+
+const (
+	window    = iota // admission window, LRU
+	probation        // main cache, entries seen once there
+	protected        // main cache, entries hit while in probation
+)
+
+// Cache is a W-TinyLFU cache. New entries enter a small LRU window, and
+// the ones leaving it are only admitted into the main segmented LRU if a
+// count-min sketch estimates them more frequent than the entry they
+// would evict. It is not safe for concurrent cases.
+type Cache struct {
+	maxBytes     int64
+	windowCap    int64
+	protectedCap int64
+	lists        [3]*list.List
+	sizes        [3]int64
+	cache        map[string]*list.Element
+	sketch       *sketch
+	// optional and executed when an entry is purged
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key     string
+	val     Value
+	expire  time.Time // zero means never
+	size    int64
+	segment int
+}
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	// guess the number of entries assuming 64 bytes each
+	width := int(maxBytes / 64)
+	if width < 64 {
+		width = 64
+	}
+	if width > 1<<20 {
+		width = 1 << 20
+	}
+	if maxBytes == 0 {
+		width = 1 << 16
+	}
+
+	windowCap := maxBytes / 100
+	c := &Cache{
+		maxBytes:     maxBytes,
+		windowCap:    windowCap,
+		protectedCap: (maxBytes - windowCap) * 8 / 10,
+		cache:        make(map[string]*list.Element),
+		sketch:       newSketch(width),
+		OnEvicted:    onEvicted,
+	}
+	for i := range c.lists {
+		c.lists[i] = list.New()
+	}
+	return c
+}
+
+// Len return the number of cache entries
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes return the size of the cache entries, keys included
+func (c *Cache) Bytes() int64 {
+	return c.sizes[window] + c.sizes[probation] + c.sizes[protected]
+}
+
+// Get find key's value, every lookup is counted by the sketch
+func (c *Cache) Get(key string) (val Value, ok bool) {
+	c.sketch.increment(key)
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if !kv.expire.IsZero() && time.Now().After(kv.expire) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	c.hit(ele)
+	return kv.val, true
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, val Value) {
+	c.AddWithExpire(key, val, time.Time{})
+}
+
+// AddWithExpire adds a value which expires at expire, the zero time
+// means never
+func (c *Cache) AddWithExpire(key string, val Value, expire time.Time) {
+	size := int64(len(key)) + int64(val.Len())
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.sizes[kv.segment] += size - kv.size
+		kv.val, kv.expire, kv.size = val, expire, size
+		c.hit(ele)
+	} else {
+		c.sketch.increment(key)
+		kv := &entry{key: key, val: val, expire: expire, size: size, segment: window}
+		c.cache[key] = c.lists[window].PushFront(kv)
+		c.sizes[window] += size
+	}
+	c.evict()
+}
+
+// hit moves the entry up: window and protected entries to the front,
+// probation entries into protected
+func (c *Cache) hit(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.segment != probation {
+		c.lists[kv.segment].MoveToFront(ele)
+		return
+	}
+	c.move(ele, protected)
+	for c.sizes[protected] > c.protectedCap && c.lists[protected].Len() > 1 {
+		c.move(c.lists[protected].Back(), probation)
+	}
+}
+
+// evict enforces the byte budget. While the window is over its share,
+// its oldest entry competes with the oldest one of the main cache, and
+// the less frequent of the two is dropped.
+func (c *Cache) evict() {
+	for c.maxBytes != 0 && c.Bytes() > c.maxBytes {
+		victim := c.lists[probation].Back()
+		if victim == nil {
+			victim = c.lists[protected].Back()
+		}
+		if c.sizes[window] > c.windowCap && c.lists[window].Len() > 0 {
+			candidate := c.lists[window].Back()
+			if victim == nil {
+				c.removeElement(candidate)
+				continue
+			}
+			ckey := candidate.Value.(*entry).key
+			vkey := victim.Value.(*entry).key
+			if c.sketch.estimate(ckey) > c.sketch.estimate(vkey) {
+				c.removeElement(victim)
+				c.move(candidate, probation)
+			} else {
+				c.removeElement(candidate)
+			}
+			continue
+		}
+		if victim == nil {
+			victim = c.lists[window].Back()
+		}
+		c.removeElement(victim)
+	}
+	// what's left over the window share fits, admit it
+	for c.sizes[window] > c.windowCap && c.lists[window].Len() > 0 {
+		c.move(c.lists[window].Back(), probation)
+	}
+}
+
+// Remove removes key, it reports whether the key was present
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes all the expired entries and returns how many
+// were removed
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, ele := range c.cache {
+		kv := ele.Value.(*entry)
+		if !kv.expire.IsZero() && now.After(kv.expire) {
+			c.removeElement(ele)
+			n++
+		}
+	}
+	return n
+}
+
+// move puts the entry in front of the segment to
+func (c *Cache) move(ele *list.Element, to int) {
+	kv := ele.Value.(*entry)
+	c.lists[kv.segment].Remove(ele)
+	c.sizes[kv.segment] -= kv.size
+	kv.segment = to
+	c.cache[kv.key] = c.lists[to].PushFront(kv)
+	c.sizes[to] += kv.size
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.lists[kv.segment].Remove(ele)
+	c.sizes[kv.segment] -= kv.size
+	delete(c.cache, kv.key)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.val)
+	}
+}
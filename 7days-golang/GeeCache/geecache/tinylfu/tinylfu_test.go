@@ -0,0 +1,95 @@
+package tinylfu
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (s String) Len() int {
+	return len(s)
+}
+
+func TestGet(t *testing.T) {
+	lfu := New(int64(0), nil)
+	lfu.Add("key1", String("1234"))
+
+	if v, ok := lfu.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Errorf("cache hit key1=1234 failed")
+	}
+
+	if _, ok := lfu.Get("key2"); ok {
+		t.Errorf("cache miss key2 failed")
+	}
+}
+
+func TestSketch(t *testing.T) {
+	s := newSketch(64)
+	for i := 0; i < 20; i++ {
+		s.increment("hot")
+	}
+	s.increment("cold")
+	if got := s.estimate("hot"); got != 15 {
+		t.Fatalf("estimate(hot) = %d, want 15 (saturated)", got)
+	}
+	if got := s.estimate("cold"); got < 1 || got >= 15 {
+		t.Fatalf("estimate(cold) = %d", got)
+	}
+	s.reset()
+	if got := s.estimate("hot"); got != 7 {
+		t.Fatalf("estimate(hot) = %d after reset, want 7", got)
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	evicted := 0
+	// room for ten entries of 5 bytes
+	lfu := New(int64(50), func(string, Value) { evicted++ })
+
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("h%02d", i)
+		lfu.Add(key, String("vv"))
+		for j := 0; j < 3; j++ {
+			lfu.Get(key)
+		}
+	}
+	// one-off keys are less frequent than the hot ones, so they're not
+	// admitted once the cache is full
+	for i := 0; i < 100; i++ {
+		lfu.Add(fmt.Sprintf("s%02d", i), String("vv"))
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := lfu.Get(fmt.Sprintf("h%02d", i)); !ok {
+			t.Fatalf("hot key h%d evicted by a scan", i)
+		}
+	}
+	if lfu.Len() != 10 || lfu.Bytes() != 50 || evicted != 95 {
+		t.Fatalf("len %d bytes %d evicted %d, want 10, 50 and 95", lfu.Len(), lfu.Bytes(), evicted)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	evicted := 0
+	lfu := New(int64(0), func(string, Value) { evicted++ })
+	lfu.Add("key1", String("1234"))
+	lfu.Add("key1", String("123456"))
+	lfu.AddWithExpire("key2", String("12"), time.Now().Add(-time.Second))
+	lfu.Get("key1")
+	if lfu.Bytes() != int64(len("key1123456key212")) {
+		t.Fatalf("bytes %d after update", lfu.Bytes())
+	}
+
+	if n := lfu.RemoveExpired(); n != 1 || lfu.Bytes() != int64(len("key1123456")) {
+		t.Fatalf("RemoveExpired removed %d, bytes %d", n, lfu.Bytes())
+	}
+	if !lfu.Remove("key1") || lfu.Bytes() != 0 || lfu.Len() != 0 || evicted != 2 {
+		t.Fatalf("bytes %d len %d evicted %d after Remove", lfu.Bytes(), lfu.Len(), evicted)
+	}
+	for i, size := range lfu.sizes {
+		if size != 0 {
+			t.Fatalf("segment %d holds %d bytes after Remove", i, size)
+		}
+	}
+}
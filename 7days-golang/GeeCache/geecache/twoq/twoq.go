@@ -0,0 +1,189 @@
+package twoq
+
+import (
+	"container/list"
+	"geecache/lru"
+	"time"
+)
+
+// Value is the interface of cached values, shared with lru
+type Value = lru.Value
+
+// Cache is a 2Q cache. New keys enter the recent FIFO queue, keys
+// evicted from it are remembered in a ghost queue, and only keys seen
+// again after that make it into the frequent LRU queue, which protects
+// it from one-off scans. It is not safe for concurrent cases.
+type Cache struct {
+	maxBytes  int64
+	nBytes    int64
+	recent    *list.List // A1in, FIFO
+	frequent  *list.List // Am, LRU
+	ghosts    *list.List // A1out, keys only
+	recentCap int64      // bytes of A1in before it's evicted from
+	ghostCap  int64      // bytes of keys remembered in A1out
+	nRecent   int64
+	nGhosts   int64
+	cache     map[string]*list.Element
+	ghostKeys map[string]*list.Element
+	// optional and executed when an entry is purged
+	OnEvicted func(key string, value Value)
+}
+
+type entry struct {
+	key      string
+	val      Value
+	expire   time.Time // zero means never
+	frequent bool
+}
+
+func New(maxBytes int64, onEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		recent:    list.New(),
+		frequent:  list.New(),
+		ghosts:    list.New(),
+		recentCap: maxBytes / 4,
+		ghostCap:  maxBytes / 2,
+		cache:     make(map[string]*list.Element),
+		ghostKeys: make(map[string]*list.Element),
+		OnEvicted: onEvicted,
+	}
+}
+
+// Len return the number of cache entries
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
+
+// Bytes return the size of the cache entries, keys included
+func (c *Cache) Bytes() int64 {
+	return c.nBytes
+}
+
+// Get find key's value, only the frequent queue is reordered
+func (c *Cache) Get(key string) (val Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if !kv.expire.IsZero() && time.Now().After(kv.expire) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	if kv.frequent {
+		c.frequent.MoveToFront(ele)
+	}
+	return kv.val, true
+}
+
+// Add adds a value to the cache.
+func (c *Cache) Add(key string, val Value) {
+	c.AddWithExpire(key, val, time.Time{})
+}
+
+// AddWithExpire adds a value which expires at expire, the zero time
+// means never
+func (c *Cache) AddWithExpire(key string, val Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		delta := int64(val.Len()) - int64(kv.val.Len())
+		c.nBytes += delta
+		if kv.frequent {
+			c.frequent.MoveToFront(ele)
+		} else {
+			c.nRecent += delta
+		}
+		kv.val = val
+		kv.expire = expire
+	} else {
+		kv := &entry{key: key, val: val, expire: expire}
+		size := int64(len(key)) + int64(val.Len())
+		if ghost, ok := c.ghostKeys[key]; ok {
+			// seen again after leaving A1in, it's a frequent key
+			c.removeGhost(ghost)
+			kv.frequent = true
+			c.cache[key] = c.frequent.PushFront(kv)
+		} else {
+			c.cache[key] = c.recent.PushFront(kv)
+			c.nRecent += size
+		}
+		c.nBytes += size
+	}
+
+	for c.maxBytes != 0 && c.maxBytes < c.nBytes {
+		c.RemoveOldest()
+	}
+}
+
+// RemoveOldest evicts from A1in if it's over its share or A1out is
+// empty, and from Am otherwise
+func (c *Cache) RemoveOldest() {
+	if c.recent.Len() > 0 && (c.nRecent > c.recentCap || c.frequent.Len() == 0) {
+		ele := c.recent.Back()
+		key := ele.Value.(*entry).key
+		c.removeElement(ele)
+		c.addGhost(key)
+		return
+	}
+	if ele := c.frequent.Back(); ele != nil {
+		c.removeElement(ele)
+	}
+}
+
+// Remove removes key, it reports whether the key was present
+func (c *Cache) Remove(key string) bool {
+	if ghost, ok := c.ghostKeys[key]; ok {
+		c.removeGhost(ghost)
+	}
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+// RemoveExpired removes all the expired entries and returns how many
+// were removed
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	n := 0
+	for _, ele := range c.cache {
+		kv := ele.Value.(*entry)
+		if !kv.expire.IsZero() && now.After(kv.expire) {
+			c.removeElement(ele)
+			n++
+		}
+	}
+	return n
+}
+
+func (c *Cache) addGhost(key string) {
+	c.ghostKeys[key] = c.ghosts.PushFront(key)
+	c.nGhosts += int64(len(key))
+	for c.nGhosts > c.ghostCap && c.ghosts.Len() > 0 {
+		c.removeGhost(c.ghosts.Back())
+	}
+}
+
+func (c *Cache) removeGhost(ele *list.Element) {
+	key := c.ghosts.Remove(ele).(string)
+	delete(c.ghostKeys, key)
+	c.nGhosts -= int64(len(key))
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	size := int64(len(kv.key)) + int64(kv.val.Len())
+	if kv.frequent {
+		c.frequent.Remove(ele)
+	} else {
+		c.recent.Remove(ele)
+		c.nRecent -= size
+	}
+	delete(c.cache, kv.key)
+	c.nBytes -= size
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.val)
+	}
+}
@@ -0,0 +1,74 @@
+package twoq
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (s String) Len() int {
+	return len(s)
+}
+
+func TestGet(t *testing.T) {
+	q := New(int64(0), nil)
+	q.Add("key1", String("1234"))
+
+	if v, ok := q.Get("key1"); !ok || string(v.(String)) != "1234" {
+		t.Errorf("cache hit key1=1234 failed")
+	}
+
+	if _, ok := q.Get("key2"); ok {
+		t.Errorf("cache miss key2 failed")
+	}
+}
+
+func TestScanResistance(t *testing.T) {
+	evicted := 0
+	// room for ten entries of 5 bytes
+	q := New(int64(50), func(string, Value) { evicted++ })
+
+	// hot keys go through A1in and A1out once, then stay in Am
+	for i := 0; i < 5; i++ {
+		q.Add(fmt.Sprintf("h%02d", i), String("vv"))
+	}
+	for i := 0; i < 10; i++ {
+		q.Add(fmt.Sprintf("f%02d", i), String("vv"))
+	}
+	for i := 0; i < 5; i++ {
+		q.Add(fmt.Sprintf("h%02d", i), String("vv"))
+	}
+
+	// a scan of one-off keys only churns A1in
+	for i := 0; i < 100; i++ {
+		q.Add(fmt.Sprintf("s%02d", i), String("vv"))
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := q.Get(fmt.Sprintf("h%02d", i)); !ok {
+			t.Fatalf("hot key h%d evicted by a scan", i)
+		}
+	}
+	if q.Len() != 10 || q.Bytes() != 50 || evicted != 110 {
+		t.Fatalf("len %d bytes %d evicted %d, want 10, 50 and 110", q.Len(), q.Bytes(), evicted)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	evicted := 0
+	q := New(int64(0), func(string, Value) { evicted++ })
+	q.Add("key1", String("1234"))
+	q.Add("key1", String("123456"))
+	q.AddWithExpire("key2", String("12"), time.Now().Add(-time.Second))
+	if q.Bytes() != int64(len("key1123456key212")) || q.nRecent != q.Bytes() {
+		t.Fatalf("bytes %d recent %d after update", q.Bytes(), q.nRecent)
+	}
+
+	if _, ok := q.Get("key2"); ok || q.Bytes() != int64(len("key1123456")) {
+		t.Fatalf("expired key2 hit, bytes %d", q.Bytes())
+	}
+	if !q.Remove("key1") || q.Bytes() != 0 || q.nRecent != 0 || evicted != 2 {
+		t.Fatalf("bytes %d len %d evicted %d after Remove", q.Bytes(), q.Len(), evicted)
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"geecache"
+	"geecache/consistenthash"
 	"log"
 	"net/http"
+	"strings"
 )
 
 var db = map[string]string{
@@ -28,18 +31,58 @@ func createGroup() *geecache.Group {
 	}))
 }
 
-func startCacheServer(addr string, addrs []string, gee *geecache.Group) {
-	peers := geecache.NewHTTPPool(addr)
-	peers.Set(addrs...)
+// pickers are the algorithms mapping keys to peers
+var pickers = map[string]func(int, consistenthash.Hash) consistenthash.Picker{
+	"ring": func(replicas int, fn consistenthash.Hash) consistenthash.Picker {
+		return consistenthash.New(replicas, fn)
+	},
+	"rendezvous": func(_ int, fn consistenthash.Hash) consistenthash.Picker {
+		return consistenthash.NewRendezvous(fn)
+	},
+	"jump": func(_ int, fn consistenthash.Hash) consistenthash.Picker {
+		return consistenthash.NewJump(fn)
+	},
+	"maglev": func(_ int, fn consistenthash.Hash) consistenthash.Picker {
+		return consistenthash.NewMaglev(0, fn)
+	},
+}
+
+func startCacheServer(addr string, members geecache.Membership, gossip http.Handler, hash string, gee *geecache.Group) {
+	newPicker, ok := pickers[hash]
+	if !ok {
+		log.Fatalf("unknown hash %q", hash)
+	}
+	peers := geecache.NewHTTPPoolOpts(addr, &geecache.HTTPPoolOptions{NewPicker: newPicker})
 	gee.RegisterPeers(peers)
+	members = geecache.NewHealthChecker(addr, members, geecache.HTTPHealthCheck(geecache.DefaultBasePath, nil))
+	go func() {
+		log.Fatal(members.Watch(context.Background(), peers.Set))
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle(geecache.DefaultBasePath, peers)
+	if gossip != nil {
+		mux.Handle(geecache.GossipPath, gossip)
+	}
 	log.Println("geecache is running at", addr)
-	log.Fatal(http.ListenAndServe(addr[len(protocol):], peers))
+	log.Fatal(http.ListenAndServe(addr[len(protocol):], mux))
+}
+
+func startTCPCacheServer(addr string, members geecache.Membership, gee *geecache.Group) {
+	peers := geecache.NewTCPPool(addr)
+	gee.RegisterPeers(peers)
+	members = geecache.NewHealthChecker(addr, members, geecache.TCPHealthCheck)
+	go func() {
+		log.Fatal(members.Watch(context.Background(), peers.Set))
+	}()
+	log.Println("geecache is running at", addr, "over tcp")
+	log.Fatal(peers.ListenAndServe())
 }
 
 func startAPIServer(apiAddr string, gee *geecache.Group) {
 	http.Handle("/api", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		key := req.URL.Query().Get("key")
-		view, err := gee.Get(key)
+		view, err := gee.GetContext(req.Context(), key)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -54,28 +97,60 @@ func startAPIServer(apiAddr string, gee *geecache.Group) {
 
 func main() {
 	var (
-		port int
-		api  bool
+		port      int
+		api       bool
+		transport string
+		peerList  string
+		peersFile string
+		gossip    bool
+		hash      string
 	)
 	flag.IntVar(&port, "port", 8001, "GeeCache server port")
 	flag.BoolVar(&api, "api", false, "Start a api server")
+	flag.StringVar(&transport, "transport", "http", "Peer transport, http or tcp")
+	flag.StringVar(&peerList, "peers", "http://localhost:8001,http://localhost:8002,http://localhost:8003",
+		"Comma separated peers, the gossip seeds with -gossip")
+	flag.StringVar(&peersFile, "peers-file", "", "Read the peers from a file, one per line, instead of -peers")
+	flag.BoolVar(&gossip, "gossip", false, "Discover the peers by gossip, http only")
+	flag.StringVar(&hash, "hash", "ring", "Key to peer mapping, ring, rendezvous, jump or maglev, http only")
 	flag.Parse()
 
 	apiAddr := "http://localhost:9999"
-	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+	addr := fmt.Sprintf("http://localhost:%d", port)
+	addrs := strings.Split(peerList, ",")
+	if transport == "tcp" {
+		if gossip {
+			log.Fatal("gossip needs the http transport")
+		}
+		// peers are host:port without scheme
+		addr = addr[len(protocol):]
+		for i, peer := range addrs {
+			addrs[i] = strings.TrimPrefix(peer, protocol)
+		}
 	}
 
-	var addrs []string
-	for _, v := range addrMap {
-		addrs = append(addrs, v)
+	var (
+		members       geecache.Membership = geecache.StaticMembership(addrs)
+		gossipHandler http.Handler
+	)
+	switch {
+	case peersFile != "":
+		members = geecache.NewFileMembership(peersFile)
+	case gossip:
+		m := geecache.NewGossipMembership(addr, addrs...)
+		members, gossipHandler = m, m
 	}
 
 	gee := createGroup()
 	if api {
 		go startAPIServer(apiAddr, gee)
 	}
-	startCacheServer(addrMap[port], addrs, gee)
+	switch transport {
+	case "http":
+		startCacheServer(addr, members, gossipHandler, hash, gee)
+	case "tcp":
+		startTCPCacheServer(addr, members, gee)
+	default:
+		log.Fatalf("unknown transport %q", transport)
+	}
 }